@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+)
+
+type ConfigParameters struct {
+	LoggerParameters
+	SerialParameters
+
+	AutoShutdownTime int
+}
+
+func runConfig(args []string) {
+	params := ConfigParameters{}
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	params.SerialParameters.RegisterFlags(flags)
+	flags.IntVar(&params.AutoShutdownTime, "autoShutdown", 0, "Idle time before the printer turns off in steps of 15 minutes, 1 to 4 on most models")
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	if !params.SerialParameters.IsValidConfig() {
+		os.Exit(1)
+	}
+
+	changed := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		changed[f.Name] = true
+	})
+
+	// Scripts provisioning several printers rely on the exit status
+	if !params.apply(changed) {
+		os.Exit(1)
+	}
+}
+
+// apply writes the settings named in changed and prints the current values.
+// It reports whether everything succeeded.
+func (params *ConfigParameters) apply(changed map[string]bool) bool {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	printer, err := params.Connect(ctx)
+	if err != nil {
+		logger.LogError("Error connecting to printer", err)
+		return false
+	}
+	defer printer.Close()
+
+	failed := false
+	if changed["autoShutdown"] {
+		if _, err := printer.SetAutoShutdownTime(ctx, params.AutoShutdownTime); err != nil {
+			logger.LogError("Error setting auto shutdown time", err)
+			failed = true
+		}
+	}
+
+	info, err := printer.GetDeviceInfo(ctx)
+	if err != nil {
+		logger.LogError("Error reading printer settings", err)
+		return false
+	}
+	logger.LogInfo("Auto shutdown time:", info.AutoShutdownTime)
+	logger.LogInfo("Language:", info.LanguageType)
+	logger.LogInfo("Print speed:", info.PrintSpeed)
+
+	return !failed
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/dissector"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+)
+
+type DecodeParameters struct {
+	LoggerParameters
+
+	File   string
+	Raw    bool
+	Render string
+}
+
+func runDecode(args []string) {
+	params := DecodeParameters{}
+	flags := flag.NewFlagSet("decode", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	flags.StringVar(&params.File, "file", "", "Capture file or debug log to decode, - for stdin")
+	flags.BoolVar(&params.Raw, "raw", false, "Print the raw bytes of every frame")
+	flags.StringVar(&params.Render, "render", "", "Directory where the printed pages are written as PNG")
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	var input io.Reader
+	switch {
+	case params.File == "-":
+		input = os.Stdin
+	case params.File != "":
+		file, err := os.Open(params.File)
+		if err != nil {
+			logger.LogError("Error opening file", params.File)
+			return
+		}
+		defer file.Close()
+		input = file
+	case flags.NArg() > 0:
+		input = strings.NewReader(strings.Join(flags.Args(), "\n"))
+	default:
+		logger.LogError("Give hex frames as arguments or a file with --file")
+		return
+	}
+
+	frames, err := dissector.Decode(input)
+	if err != nil {
+		logger.LogError("Error reading input", err)
+	}
+	for _, frame := range frames {
+		if params.Raw && frame.Err == nil {
+			logger.LogInfo(frame.String(), "|", hex.EncodeToString(frame.Raw))
+		} else {
+			logger.LogInfo(frame.String())
+		}
+	}
+	if params.Render != "" {
+		renderPages(frames, params.Render)
+	}
+}
+
+// renderPages writes every page sent in frames to dir.
+func renderPages(frames []dissector.Frame, dir string) {
+	pages, err := dissector.Render(frames)
+	if err != nil {
+		logger.LogError("Error rendering pages", err)
+	}
+	if len(pages) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		logger.LogError("Error creating output directory", dir)
+		return
+	}
+	for i, page := range pages {
+		path := filepath.Join(dir, fmt.Sprintf("page-%04d.png", i+1))
+		if err := writePNG(path, page); err != nil {
+			logger.LogError("Error writing page", path, err)
+			return
+		}
+		logger.LogInfo("Rendered page to", path)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+)
+
+type DiscoverParameters struct {
+	LoggerParameters
+	SerialParameters
+
+	Ports string
+}
+
+func runDiscover(args []string) {
+	params := DiscoverParameters{}
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	params.SerialParameters.RegisterFlags(flags)
+	flags.StringVar(&params.Ports, "ports", "", "Comma separated ports to probe instead of every port the OS reports")
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	mode, err := params.Mode()
+	if err != nil {
+		logger.LogError("Invalid serial settings", err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	logger.LogInfo("Searching for printers...")
+	var found []niimbot.DiscoveredPrinter
+	if params.Ports != "" {
+		found = niimbot.DiscoverPorts(ctx, strings.Split(params.Ports, ","), mode)
+	} else {
+		found, err = niimbot.Discover(ctx, mode)
+		if err != nil {
+			logger.LogError("Error listing serial ports", err)
+			return
+		}
+	}
+
+	if len(found) == 0 {
+		logger.LogInfo("No printer found")
+		return
+	}
+	for _, printer := range found {
+		logger.LogInfo("Found", printer.Model, "on", printer.Port, "serial", printer.Serial)
+	}
+}
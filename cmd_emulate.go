@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/emulator"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+)
+
+type EmulateParameters struct {
+	LoggerParameters
+
+	OutputDir string
+	Model     string
+}
+
+func runEmulate(args []string) {
+	params := EmulateParameters{}
+	flags := flag.NewFlagSet("emulate", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	flags.StringVar(&params.OutputDir, "outputDir", ".", "Directory where printed labels are written as PNG")
+	flags.StringVar(&params.Model, "model", "D11", "Printer model to emulate")
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	profile, ok := niimbot.ProfileByModel(params.Model)
+	if !ok {
+		logger.LogError("Unknown printer model", params.Model)
+		return
+	}
+
+	if err := os.MkdirAll(params.OutputDir, 0o755); err != nil {
+		logger.LogError("Error creating output directory", params.OutputDir)
+		return
+	}
+
+	pty, err := emulator.OpenPTY()
+	if err != nil {
+		logger.LogError("Error opening pseudo-terminal", err)
+		return
+	}
+	defer pty.Close()
+
+	logger.LogInfo("Virtual", profile.Model, "printer listening on", pty.Path)
+	printer := emulator.NewVirtualPrinter(params.OutputDir)
+	printer.DeviceType = profile.DeviceTypes[0]
+	if err := printer.Serve(pty); err != nil {
+		logger.LogError("Virtual printer stopped", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+)
+
+type InfoParameters struct {
+	LoggerParameters
+	SerialParameters
+}
+
+func runInfo(args []string) {
+	params := InfoParameters{}
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	params.SerialParameters.RegisterFlags(flags)
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	if !params.SerialParameters.IsValidConfig() {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	printer, err := params.Connect(ctx)
+	if err != nil {
+		logger.LogError("Error connecting to printer", err)
+		return
+	}
+	defer printer.Close()
+
+	info, err := printer.GetDeviceInfo(ctx)
+	if err != nil {
+		logger.LogError("Error reading printer info", err)
+		return
+	}
+
+	logger.LogInfo("Model:", fmt.Sprintf("%s (device type %d)", info.Model, info.DeviceType))
+	logger.LogInfo("Serial:", info.Serial)
+	logger.LogInfo("Software version:", info.SoftVersion)
+	logger.LogInfo("Hardware version:", info.HardVersion)
+	logger.LogInfo("Battery:", fmt.Sprintf("%d/4", info.Battery))
+	logger.LogInfo("Density:", info.Density)
+	logger.LogInfo("Print speed:", info.PrintSpeed)
+	logger.LogInfo("Label type:", info.LabelType)
+	logger.LogInfo("Language:", info.LanguageType)
+	logger.LogInfo("Auto shutdown time:", info.AutoShutdownTime)
+
+	status, err := printer.Heartbeat(ctx)
+	if err != nil {
+		logger.LogError("Error reading printer status", err)
+	} else {
+		logger.LogInfo("Status:", status)
+	}
+
+	roll, err := printer.ReadRFID(ctx)
+	switch {
+	case errors.Is(err, niimbot.ErrNoRFIDTag):
+		logger.LogInfo("Label roll: no RFID tag")
+	case err != nil:
+		logger.LogError("Error reading label roll", err)
+	default:
+		logger.LogInfo("Label roll:", roll.Barcode, "serial", roll.Serial, "uuid", roll.UUID)
+		logger.LogInfo("Label roll usage:", fmt.Sprintf("%d/%d labels, label type %d", roll.UsedLength, roll.TotalLength, roll.LabelType))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+)
+
+type MonitorParameters struct {
+	LoggerParameters
+	SerialParameters
+
+	Interval time.Duration
+}
+
+func runMonitor(args []string) {
+	params := MonitorParameters{}
+	flags := flag.NewFlagSet("monitor", flag.ExitOnError)
+	params.LoggerParameters.RegisterFlags(flags)
+	params.SerialParameters.RegisterFlags(flags)
+	flags.DurationVar(&params.Interval, "interval", 10*time.Second, "Time between heartbeats")
+	flags.Parse(args)
+
+	params.ConfigureLogger()
+
+	if !params.SerialParameters.IsValidConfig() {
+		return
+	}
+	if params.Interval <= 0 {
+		logger.LogError("Invalid interval", params.Interval)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	printer, err := params.Connect(ctx)
+	if err != nil {
+		logger.LogError("Error connecting to printer", err)
+		return
+	}
+	defer printer.Close()
+
+	monitor := printer.StartMonitor(ctx, params.Interval)
+	defer monitor.Stop()
+
+	logger.LogInfo("Monitoring printer every", params.Interval)
+	for event := range monitor.Events {
+		switch event.Type {
+		case niimbot.EventConnectionLost:
+			logger.LogError("Printer connection lost", event.Err)
+		case niimbot.EventBatteryChanged:
+			logger.LogInfo("Battery:", fmt.Sprintf("%d/4", event.Status.BatteryLevel))
+		default:
+			logger.LogInfo("Printer", event.Type.String())
+		}
+	}
+}
@@ -3,13 +3,15 @@ module github.com/matheustavarestrindade/niimprintgo
 go 1.22.0
 
 require (
+	github.com/disintegration/imaging v1.6.2
 	go.bug.st/serial v1.6.2
+	golang.org/x/image v0.15.0
+	golang.org/x/sys v0.11.0
 	golang.org/x/tools v0.1.11
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
-	github.com/disintegration/imaging v1.6.2 // indirect
 	github.com/fatih/structs v1.1.0 // indirect
 	github.com/go-ble/ble v0.0.0-20240122180141-8c5522f54333 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
@@ -19,7 +21,5 @@ require (
 	github.com/saltosystems/winrt-go v0.0.0-20230921082907-2ab5b7d431e1 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/tinygo-org/cbgo v0.0.4 // indirect
-	golang.org/x/image v0.15.0 // indirect
-	golang.org/x/sys v0.11.0 // indirect
 	tinygo.org/x/bluetooth v0.8.0 // indirect
 )
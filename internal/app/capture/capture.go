@@ -0,0 +1,118 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	DirectionSend    Direction = "send"
+	DirectionReceive Direction = "receive"
+)
+
+// Record is one chunk of raw bytes written to or read from the port, stored
+// as a line of JSON with the bytes in hex. A chunk may hold part of a frame
+// or several frames.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"direction"`
+	Data      HexBytes  `json:"data"`
+}
+
+type HexBytes []byte
+
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+func (h *HexBytes) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = data
+	return nil
+}
+
+// Writer appends records to a capture file. It is safe to use from several
+// goroutines.
+type Writer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+	closed  bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{encoder: json.NewEncoder(w)}
+}
+
+// Create truncates or creates the capture file at path.
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := NewWriter(file)
+	writer.closer = file
+	return writer, nil
+}
+
+func (w *Writer) Write(direction Direction, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.encoder.Encode(Record{
+		Time:      time.Now(),
+		Direction: direction,
+		Data:      append(HexBytes(nil), data...),
+	})
+}
+
+// Close stops recording and closes the file opened by Create. Records written
+// afterwards are dropped.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+func Read(r io.Reader) ([]Record, error) {
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("Invalid capture record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
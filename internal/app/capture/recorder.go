@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"go.bug.st/serial"
+)
+
+// Recorder is a serial.Port that writes the raw bytes going through the
+// wrapped port to a capture, chunk by chunk as they are written and read.
+// Nothing is framed, so partial and corrupted frames are kept for replay.
+type Recorder struct {
+	serial.Port
+	Writer *Writer
+}
+
+func NewRecorder(port serial.Port, writer *Writer) *Recorder {
+	return &Recorder{
+		Port:   port,
+		Writer: writer,
+	}
+}
+
+// Write records data before writing it, the response can be read before the
+// write returns.
+func (r *Recorder) Write(data []byte) (int, error) {
+	r.record(DirectionSend, data)
+	return r.Port.Write(data)
+}
+
+func (r *Recorder) Read(buffer []byte) (int, error) {
+	n, err := r.Port.Read(buffer)
+	if n > 0 {
+		r.record(DirectionReceive, buffer[:n])
+	}
+	return n, err
+}
+
+// Close closes the wrapped port and then the Writer.
+func (r *Recorder) Close() error {
+	err := r.Port.Close()
+	if closeErr := r.Writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// record never fails the port, a broken capture should not stop a print
+func (r *Recorder) record(direction Direction, data []byte) {
+	if err := r.Writer.Write(direction, data); err != nil {
+		logger.LogError("Error writing capture", err)
+	}
+}
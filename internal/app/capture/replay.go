@@ -0,0 +1,151 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var (
+	ErrUnexpectedPacket = errors.New("Packet does not match the capture")
+	ErrCaptureEnded     = errors.New("Capture has no more packets to replay")
+	ErrReplayClosed     = errors.New("Replay transport is closed")
+)
+
+// Replay is a Transport that plays a capture back as a scripted printer.
+// Every sent packet must match the next recorded send, the bytes recorded as
+// received after it are then framed and received in order.
+type Replay struct {
+	ReadTimeout time.Duration
+
+	mu      sync.Mutex
+	records []Record
+	next    int
+	framer  *packets.Framer
+	queue   []received
+	notify  chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func NewReplay(records []Record) *Replay {
+	r := &Replay{
+		ReadTimeout: 200 * time.Millisecond,
+
+		records: records,
+		framer:  packets.NewFramer(),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	// Frames the printer sent before the first request
+	r.queueResponses()
+	return r
+}
+
+func (r *Replay) SendPacket(pkt *packets.NiimbotPacket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrReplayClosed
+	}
+	if r.next >= len(r.records) {
+		return fmt.Errorf("%w: sent %s", ErrCaptureEnded, hex.EncodeToString(pkt.ToBytes()))
+	}
+
+	expected := r.records[r.next]
+	sent := pkt.ToBytes()
+	if expected.Direction != DirectionSend || !bytes.Equal(expected.Data, sent) {
+		return fmt.Errorf("%w: expected %s, sent %s", ErrUnexpectedPacket, hex.EncodeToString(expected.Data), hex.EncodeToString(sent))
+	}
+	r.next++
+	r.queueResponses()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (r *Replay) ReceivePacket() (*packets.NiimbotPacket, error) {
+	if pkt, err := r.pop(); pkt != nil || err != nil {
+		return pkt, err
+	}
+
+	timer := time.NewTimer(r.ReadTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.notify:
+	case <-timer.C:
+	case <-r.done:
+	}
+	return r.pop()
+}
+
+func (r *Replay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	return nil
+}
+
+// Remaining returns how many recorded sends were not replayed yet.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for _, record := range r.records[r.next:] {
+		if record.Direction == DirectionSend {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// received is a packet or the error framing it, as the serial socket
+// returns them.
+type received struct {
+	pkt *packets.NiimbotPacket
+	err error
+}
+
+// queueResponses frames the bytes received up to the next send and queues
+// the packets. Garbage is skipped and corrupted frames are replayed as
+// errors the way the serial socket handles them, and a frame cut short waits
+// for the bytes received after the next send.
+func (r *Replay) queueResponses() {
+	for r.next < len(r.records) && r.records[r.next].Direction == DirectionReceive {
+		r.framer.Write(r.records[r.next].Data)
+		r.next++
+	}
+	for {
+		pkt, err := r.framer.Next()
+		if pkt == nil && err == nil {
+			return
+		}
+		r.queue = append(r.queue, received{pkt: pkt, err: err})
+	}
+}
+
+func (r *Replay) pop() (*packets.NiimbotPacket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrReplayClosed
+	}
+	if len(r.queue) == 0 {
+		return nil, nil
+	}
+	next := r.queue[0]
+	r.queue = r.queue[1:]
+	return next.pkt, next.err
+}
@@ -0,0 +1,123 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+	"go.bug.st/serial"
+)
+
+// chunkPort is a serial.Port whose reads return the given chunks in order.
+type chunkPort struct {
+	serial.Port
+	chunks  [][]byte
+	written [][]byte
+}
+
+func (p *chunkPort) Read(buffer []byte) (int, error) {
+	if len(p.chunks) == 0 {
+		return 0, nil
+	}
+	n := copy(buffer, p.chunks[0])
+	p.chunks = p.chunks[1:]
+	return n, nil
+}
+
+func (p *chunkPort) Write(data []byte) (int, error) {
+	p.written = append(p.written, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func (p *chunkPort) Close() error {
+	return nil
+}
+
+func frame(pktType byte, data ...byte) []byte {
+	pkt := packets.NiimbotPacket{Type: pktType, Data: data}
+	return pkt.ToBytes()
+}
+
+func TestRecorderKeepsRawChunks(t *testing.T) {
+	reply := frame(0x48, 0x02, 0x00)
+	corrupt := append(frame(0xdd, 1, 2, 3)[:6], 0xaa, 0xaa)
+	chunks := [][]byte{
+		append([]byte{0x00, 0x13}, reply[:3]...),
+		reply[3:],
+		corrupt,
+	}
+
+	var buffer bytes.Buffer
+	writer := NewWriter(&buffer)
+	recorder := NewRecorder(&chunkPort{chunks: append([][]byte(nil), chunks...)}, writer)
+
+	request := frame(0x40, 0x08)
+	if _, err := recorder.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	read := make([]byte, 64)
+	for range chunks {
+		if _, err := recorder.Read(read); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Read(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([][]byte{request}, chunks...)
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, record := range records {
+		direction := DirectionReceive
+		if i == 0 {
+			direction = DirectionSend
+		}
+		if record.Direction != direction || !bytes.Equal(record.Data, want[i]) {
+			t.Errorf("record %d is %s %x, want %s %x", i, record.Direction, record.Data, direction, want[i])
+		}
+	}
+}
+
+func TestReplayFramesChunks(t *testing.T) {
+	first := frame(0x48, 0x02, 0x00)
+	second := frame(0xe0, 0x00, 0x01)
+	records := []Record{
+		{Direction: DirectionSend, Data: frame(0x40, 0x08)},
+		// Garbage, a frame split in two and the start of the next one
+		{Direction: DirectionReceive, Data: append([]byte{0x00, 0x55}, first[:4]...)},
+		{Direction: DirectionReceive, Data: append(first[4:], second[:2]...)},
+		{Direction: DirectionSend, Data: frame(0xe3, 0x01)},
+		{Direction: DirectionReceive, Data: second[2:]},
+	}
+	replay := NewReplay(records)
+	defer replay.Close()
+
+	if err := replay.SendPacket(&packets.NiimbotPacket{Type: 0x40, Data: []byte{0x08}}); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := replay.ReceivePacket()
+	if err != nil || pkt == nil || pkt.Type != 0x48 {
+		t.Fatalf("got %v %v, want the first frame", pkt, err)
+	}
+
+	if err := replay.SendPacket(&packets.NiimbotPacket{Type: 0x41}); !errors.Is(err, ErrUnexpectedPacket) {
+		t.Fatalf("got %v, want ErrUnexpectedPacket", err)
+	}
+	if err := replay.SendPacket(&packets.NiimbotPacket{Type: 0xe3, Data: []byte{0x01}}); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err = replay.ReceivePacket()
+	if err != nil || pkt == nil || pkt.Type != 0xe0 {
+		t.Fatalf("got %v %v, want the frame split across sends", pkt, err)
+	}
+	if replay.Remaining() != 0 {
+		t.Errorf("%d sends left", replay.Remaining())
+	}
+}
@@ -0,0 +1,213 @@
+package dissector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/capture"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var (
+	ErrNotFrame  = errors.New("Bytes outside of a frame")
+	ErrTruncated = errors.New("Truncated frame")
+)
+
+var (
+	frameStart    = []byte{0x55, 0x55}
+	logBytes      = regexp.MustCompile(`(Sending|Received) packet \[([0-9 ]*)\]`)
+	hexSeparators = strings.NewReplacer("0x", "", "0X", "", " ", "", "\t", "", ":", "", ",", "", "-", "")
+)
+
+// Frame is one decoded frame. Packet is nil when Err is set. Direction and
+// Time are only known for captures and debug logs.
+type Frame struct {
+	Time      time.Time
+	Direction capture.Direction
+	Raw       []byte
+	Packet    *packets.NiimbotPacket
+	Err       error
+	Name      string
+	Fields    []string
+}
+
+func (f Frame) String() string {
+	arrow := "  "
+	switch f.Direction {
+	case capture.DirectionSend:
+		arrow = "->"
+	case capture.DirectionReceive:
+		arrow = "<-"
+	}
+	if f.Err != nil {
+		return fmt.Sprintf("%s %s: %s", arrow, f.Err, hex.EncodeToString(f.Raw))
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", arrow, f.Name, strings.Join(f.Fields, " ")))
+}
+
+// Decoder turns hex dumps, debug logs and capture files into annotated
+// frames. It keeps the label width from SET_DIMENSION to split image rows.
+type Decoder struct {
+	width   int
+	pending []byte
+	// streams holds the captured bytes of each direction waiting for the
+	// rest of their frame, captures record raw chunks
+	streams map[capture.Direction][]byte
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{streams: make(map[capture.Direction][]byte)}
+}
+
+// Decode reads every line of r. Lines that hold no frame are skipped.
+func Decode(r io.Reader) ([]Frame, error) {
+	decoder := NewDecoder()
+	frames := make([]Frame, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		frames = append(frames, decoder.DecodeLine(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return frames, err
+	}
+	return append(frames, decoder.Flush()...), nil
+}
+
+// DecodeLine decodes a capture record, a "Sending packet" or "Received
+// packet" debug log line, or hex. Hex frames may span several lines.
+func (d *Decoder) DecodeLine(line string) []Frame {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(line, "{") {
+		var record capture.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil
+		}
+		stream := append(d.streams[record.Direction], record.Data...)
+		frames, rest := d.split(stream, record.Direction, false)
+		d.streams[record.Direction] = rest
+		for i := range frames {
+			frames[i].Time = record.Time
+		}
+		return frames
+	}
+
+	if match := logBytes.FindStringSubmatch(line); match != nil {
+		direction := capture.DirectionSend
+		if match[1] == "Received" {
+			direction = capture.DirectionReceive
+		}
+		data := make([]byte, 0)
+		for _, field := range strings.Fields(match[2]) {
+			value, err := strconv.Atoi(field)
+			if err != nil || value > 255 {
+				return nil
+			}
+			data = append(data, byte(value))
+		}
+		frames, _ := d.split(data, direction, true)
+		return frames
+	}
+
+	data, err := hex.DecodeString(hexSeparators.Replace(line))
+	if err != nil {
+		return nil
+	}
+	frames, rest := d.split(append(d.pending, data...), "", false)
+	d.pending = rest
+	return frames
+}
+
+// Flush reports the bytes still waiting for the rest of their frame.
+func (d *Decoder) Flush() []Frame {
+	frames, _ := d.split(d.pending, "", true)
+	d.pending = nil
+	for _, direction := range []capture.Direction{capture.DirectionSend, capture.DirectionReceive} {
+		rest, _ := d.split(d.streams[direction], direction, true)
+		frames = append(frames, rest...)
+		delete(d.streams, direction)
+	}
+	return frames
+}
+
+// split cuts data into frames using the length byte. Unless final, an
+// incomplete frame at the end is returned as rest.
+func (d *Decoder) split(data []byte, direction capture.Direction, final bool) ([]Frame, []byte) {
+	frames := make([]Frame, 0)
+	for len(data) > 0 {
+		start := bytes.Index(data, frameStart)
+		if start < 0 {
+			start = len(data)
+			if !final && data[len(data)-1] == frameStart[0] {
+				start--
+			}
+		}
+		if start > 0 {
+			frames = append(frames, Frame{Direction: direction, Raw: data[:start], Err: ErrNotFrame})
+			data = data[start:]
+			continue
+		}
+
+		size := 0
+		if len(data) >= 4 {
+			size = 4 + int(data[3]) + 3
+		}
+		if size == 0 || len(data) < size {
+			// A false header must not hold back the frames after it
+			if next := nextFrame(data); next > 0 {
+				frames = append(frames, Frame{Direction: direction, Raw: data[:next], Err: ErrNotFrame})
+				data = data[next:]
+				continue
+			}
+			if !final {
+				return frames, data
+			}
+			frames = append(frames, Frame{Direction: direction, Raw: data, Err: ErrTruncated})
+			break
+		}
+
+		frame := Frame{Direction: direction, Raw: data[:size]}
+		frame.Packet, frame.Err = packets.FromBytes(frame.Raw)
+		if frame.Packet != nil {
+			d.annotate(&frame)
+		}
+		frames = append(frames, frame)
+		data = data[size:]
+	}
+	return frames, nil
+}
+
+// nextFrame returns the offset of the first complete frame with a valid
+// checksum after the start of data, 0 when there is none.
+func nextFrame(data []byte) int {
+	for i := 1; i+4 <= len(data); i++ {
+		if !bytes.HasPrefix(data[i:], frameStart) {
+			continue
+		}
+		size := 4 + int(data[i+3]) + 3
+		if i+size > len(data) || data[i+size-1] != 0xaa || data[i+size-2] != 0xaa {
+			continue
+		}
+		checksum := byte(0)
+		for _, b := range data[i+2 : i+size-3] {
+			checksum ^= b
+		}
+		if checksum == data[i+size-3] {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package dissector
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// render annotates frames one per line, the way the decode command logs
+// them.
+func render(frames []Frame) string {
+	var out strings.Builder
+	for _, frame := range frames {
+		out.WriteString(frame.String())
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// TestDecodeGolden decodes each capture in testdata and compares its
+// annotations with the .golden file next to it. Run with -update after an
+// intended change.
+func TestDecodeGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no captures in testdata")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			frames, err := Decode(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := render(frames)
+
+			golden := strings.TrimSuffix(input, ".jsonl") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("annotations differ from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestGuessChunks(t *testing.T) {
+	codes := packets.NiimbotD11RequestCodePacket
+	tests := []struct {
+		name string
+		code int
+		data []byte
+		want int
+	}{
+		{
+			name: "bitmap row of a 96 dot label",
+			code: codes.SET_IMAGE_DATA,
+			data: []byte{0x00, 0x02, 8, 0, 0, 1, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			want: 3,
+		},
+		{
+			name: "indexed row",
+			code: codes.SET_IMAGE,
+			data: []byte{0x00, 0x01, 1, 0, 1, 1, 0x00, 0x05, 0x00, 0x46},
+			want: 3,
+		},
+		{
+			name: "counts that match no body",
+			code: codes.SET_IMAGE_DATA,
+			data: []byte{0x00, 0x02, 9, 9, 9, 1, 0xff},
+			want: 0,
+		},
+		{
+			name: "too short for a header",
+			code: codes.SET_IMAGE,
+			data: []byte{0x00, 0x01, 1},
+			want: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := guessChunks(test.code, test.data); got != test.want {
+				t.Errorf("got %d chunks, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedHex(t *testing.T) {
+	good := packets.NiimbotPacket{Type: 0x40, Data: []byte{0x08}}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		{
+			name:  "frame across lines",
+			input: "55 55 40 01\n08 49 aa aa\n",
+			want:  "GET_INFO key=DEVICETYPE\n",
+		},
+		{
+			name:  "garbage before a frame",
+			input: fmt.Sprintf("00 13 % x", good.ToBytes()),
+			want:  "   Bytes outside of a frame: 0013\nGET_INFO key=DEVICETYPE\n",
+			err:   ErrNotFrame,
+		},
+		{
+			name:  "false header before a frame",
+			input: fmt.Sprintf("55 55 00 ff % x", good.ToBytes()),
+			want:  "   Bytes outside of a frame: 555500ff\nGET_INFO key=DEVICETYPE\n",
+			err:   ErrNotFrame,
+		},
+		{
+			name:  "bad checksum",
+			input: "55 55 40 01 08 00 aa aa",
+			want:  "   Invalid checksum: 555540010800aaaa\n",
+			err:   packets.ErrInvalidChecksum,
+		},
+		{
+			name:  "truncated",
+			input: "55 55 40 01 08",
+			want:  "   Truncated frame: 5555400108\n",
+			err:   ErrTruncated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames, err := Decode(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := render(frames); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+			if test.err != nil && !errors.Is(frames[0].Err, test.err) {
+				t.Errorf("first frame failed with %v, want %v", frames[0].Err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package dissector
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/capture"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+func (d *Decoder) annotate(frame *Frame) {
+	pkt := frame.Packet
+	code := int(pkt.Type)
+	data := pkt.Data
+	frame.Name = name(code, frame.Direction)
+
+	// Without a direction a frame may be either
+	sent := frame.Direction != capture.DirectionReceive
+	received := frame.Direction != capture.DirectionSend
+
+	codes := packets.NiimbotD11RequestCodePacket
+	responses := packets.NiimbotD11ResponseCodePacket
+	field := func(name string, value any) {
+		frame.Fields = append(frame.Fields, fmt.Sprintf("%s=%v", name, value))
+	}
+
+	switch {
+	case sent && code == codes.GET_INFO && len(data) == 1:
+		field("key", infoName(int(data[0])))
+	case sent && code == codes.SET_DIMENSION && len(data) >= 4:
+		height, width := short(data[0:]), short(data[2:])
+		d.width = width
+		field("height", height)
+		field("width", width)
+		if len(data) >= 6 {
+			field("copies", short(data[4:]))
+		}
+	case sent && code == codes.SET_QUANTITY && len(data) == 2:
+		field("quantity", short(data))
+	case sent && code == codes.SET_LABEL_TYPE && len(data) == 1:
+		field("type", data[0])
+	case sent && code == codes.SET_LABEL_DENSITY && len(data) == 1:
+		field("density", data[0])
+	case sent && code == codes.SET_AUTO_SHUTDOWN && len(data) == 1:
+		field("time", data[0])
+	case sent && code == codes.START_PRINT && len(data) == 7:
+		field("pages", short(data))
+	case sent && (code == codes.SET_IMAGE || code == codes.SET_IMAGE_DATA || code == codes.IMAGE_CLEAR):
+		d.annotateRow(frame, field)
+	case received && code == responses.PAGE_PRINT_DONE && len(data) >= 2:
+		field("page", short(data))
+	case received && (code == responses.ILLEGAL_ARGUMENT || code == responses.NOT_IMPLEMENT) && len(data) >= 1:
+		field("request", requestName(int(data[0])))
+	case received && code > codes.GET_INFO && infoNames[code-codes.GET_INFO] != "":
+		key := code - codes.GET_INFO
+		field("key", infoNames[key])
+		if key == packets.NiimbotD11InfoPacket.DEVICESERIAL {
+			field("value", hex.EncodeToString(data))
+		} else {
+			field("value", number(data))
+		}
+	case received && (replyNames[code] != "" || code == codes.IMAGE_CONFIRM) && len(data) == 1:
+		field("ok", data[0] != 0)
+	case len(data) > 0:
+		field("data", hex.EncodeToString(data))
+	}
+}
+
+// annotateRow decodes an image row. The row header holds one ink count per
+// 32 pixels, so its size depends on the label width.
+func (d *Decoder) annotateRow(frame *Frame, field func(string, any)) {
+	data := frame.Packet.Data
+	codes := packets.NiimbotD11RequestCodePacket
+	code := int(frame.Packet.Type)
+
+	if code == codes.IMAGE_CLEAR {
+		if len(data) != 3 {
+			field("data", hex.EncodeToString(data))
+			return
+		}
+		field("row", short(data))
+		field("repeat", data[2])
+		return
+	}
+
+	chunks := (d.width + 31) / 32
+	if d.width == 0 || !validRow(code, data, chunks) {
+		chunks = guessChunks(code, data)
+	}
+	if chunks == 0 {
+		field("data", hex.EncodeToString(data))
+		return
+	}
+
+	counts := data[2 : 2+chunks]
+	field("row", short(data))
+	field("repeat", data[2+chunks])
+	field("counts", fmt.Sprint(counts))
+
+	body := data[3+chunks:]
+	if code == codes.SET_IMAGE {
+		indexes := make([]int, 0, len(body)/2)
+		for i := 0; i+1 < len(body); i += 2 {
+			indexes = append(indexes, short(body[i:]))
+		}
+		field("pixels", fmt.Sprint(indexes))
+		return
+	}
+	ink := 0
+	for _, b := range body {
+		ink += bits.OnesCount8(b)
+	}
+	field("ink", ink)
+	field("bitmap", hex.EncodeToString(body))
+}
+
+// validRow checks that the ink counts of a row agree with its body.
+func validRow(code int, data []byte, chunks int) bool {
+	if chunks <= 0 || len(data) < 3+chunks {
+		return false
+	}
+	total := 0
+	for _, count := range data[2 : 2+chunks] {
+		total += int(count)
+	}
+	body := data[3+chunks:]
+	if code == packets.NiimbotD11RequestCodePacket.SET_IMAGE {
+		return len(body) == total*2
+	}
+	ink := 0
+	for _, b := range body {
+		ink += bits.OnesCount8(b)
+	}
+	return ink == total && len(body) <= chunks*4 && len(body) > (chunks-1)*4
+}
+
+// guessChunks finds the header size when no SET_DIMENSION was seen.
+func guessChunks(code int, data []byte) int {
+	for chunks := 1; 3+chunks <= len(data); chunks++ {
+		if validRow(code, data, chunks) {
+			return chunks
+		}
+	}
+	return 0
+}
+
+func infoName(key int) string {
+	if name, ok := infoNames[key]; ok {
+		return name
+	}
+	return fmt.Sprint(key)
+}
+
+func requestName(code int) string {
+	if name, ok := requestNames[code]; ok {
+		return name
+	}
+	return fmt.Sprint(code)
+}
+
+func short(data []byte) int {
+	return int(data[0])<<8 | int(data[1])
+}
+
+func number(data []byte) int {
+	value := 0
+	for _, b := range data {
+		value = value<<8 | int(b)
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package dissector
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/capture"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var (
+	requestNames  = codeNames(packets.NiimbotD11RequestCodePacket)
+	responseNames = codeNames(packets.NiimbotD11ResponseCodePacket)
+	infoNames     = codeNames(packets.NiimbotD11InfoPacket)
+	replyNames    = newReplyNames()
+)
+
+// codeNames maps the values of one of the packets code tables to the names
+// of their fields.
+func codeNames(table any) map[int]string {
+	names := make(map[int]string)
+	value := reflect.ValueOf(table).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		names[int(value.Field(i).Int())] = value.Type().Field(i).Name
+	}
+	return names
+}
+
+// newReplyNames names the response of every request after the request.
+func newReplyNames() map[int]string {
+	requests := []packets.Request{
+		packets.GetRFID{},
+		packets.Heartbeat{},
+		packets.SetLabelType{},
+		packets.SetLabelDensity{},
+		packets.SetAutoShutdown{},
+		packets.StartPrint{},
+		packets.EndPrint{},
+		packets.StartPagePrint{},
+		packets.EndPagePrint{},
+		packets.AllowPrintClear{},
+		packets.SetDimension{},
+		packets.SetQuantity{},
+	}
+	for key := range infoNames {
+		requests = append(requests, packets.GetInfo{Key: key})
+	}
+
+	names := make(map[int]string)
+	for _, req := range requests {
+		names[req.ResponseCode()] = requestNames[req.Code()] + "_REPLY"
+	}
+	return names
+}
+
+// name returns the name of a packet type as seen in the given direction.
+// Without a direction requests take precedence.
+func name(code int, direction capture.Direction) string {
+	tables := []map[int]string{requestNames, responseNames, replyNames}
+	if direction == capture.DirectionReceive {
+		tables = []map[int]string{responseNames, replyNames, requestNames}
+	}
+	for _, table := range tables {
+		if name, ok := table[code]; ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("UNKNOWN_%d", code)
+}
@@ -0,0 +1,50 @@
+package dissector
+
+import (
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/capture"
+	image_encoder "github.com/matheustavarestrindade/niimprintgo/internal/app/image"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// Render rebuilds every page sent in frames, from START_PAGE_PRINT to
+// END_PAGE_PRINT, sized by the SET_DIMENSION in between. Frames received
+// from the printer are skipped.
+func Render(frames []Frame) ([]*image_encoder.Bitmap, error) {
+	codes := packets.NiimbotD11RequestCodePacket
+	pages := make([]*image_encoder.Bitmap, 0)
+
+	var rows []packets.Request
+	width, height := 0, 0
+	for _, frame := range frames {
+		if frame.Packet == nil || frame.Direction == capture.DirectionReceive {
+			continue
+		}
+		data := frame.Packet.Data
+
+		switch int(frame.Packet.Type) {
+		case codes.START_PAGE_PRINT:
+			rows = nil
+			width, height = 0, 0
+		case codes.SET_DIMENSION:
+			if len(data) >= 4 {
+				height, width = short(data), short(data[2:])
+			}
+		case codes.SET_IMAGE, codes.SET_IMAGE_DATA, codes.IMAGE_CLEAR:
+			row, err := packets.ParseImageRow(frame.Packet, width)
+			if err != nil {
+				return pages, fmt.Errorf("Page %d: %w", len(pages)+1, err)
+			}
+			rows = append(rows, row)
+		case codes.END_PAGE_PRINT:
+			bitmap, err := image_encoder.DecodeRows(rows, width, height)
+			if err != nil {
+				return pages, fmt.Errorf("Page %d: %w", len(pages)+1, err)
+			}
+			pages = append(pages, bitmap)
+			rows = nil
+		}
+	}
+	return pages, nil
+}
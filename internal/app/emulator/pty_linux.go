@@ -0,0 +1,84 @@
+package emulator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTY is a Linux pseudo-terminal pair. Serial clients open Path as if it was
+// the printer's COM port while the emulator reads and writes the master side.
+type PTY struct {
+	Path string
+
+	master *os.File
+	slave  *os.File
+}
+
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, err
+	}
+	number, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	path := fmt.Sprintf("/dev/pts/%d", number)
+
+	// Keep the slave side open so reads on the master do not fail with EIO
+	// while no client is connected, and put it in raw mode so no bytes are
+	// echoed or translated before the client configures the port.
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	if err := makeRaw(int(slave.Fd())); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+
+	return &PTY{
+		Path:   path,
+		master: master,
+		slave:  slave,
+	}, nil
+}
+
+func (p *PTY) Read(data []byte) (int, error) {
+	return p.master.Read(data)
+}
+
+func (p *PTY) Write(data []byte) (int, error) {
+	return p.master.Write(data)
+}
+
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
+
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package emulator
+
+import "errors"
+
+type PTY struct {
+	Path string
+}
+
+func OpenPTY() (*PTY, error) {
+	return nil, errors.New("Pseudo-terminals are only supported on Linux")
+}
+
+func (p *PTY) Read(data []byte) (int, error) {
+	return 0, errors.New("Pseudo-terminals are only supported on Linux")
+}
+
+func (p *PTY) Write(data []byte) (int, error) {
+	return 0, errors.New("Pseudo-terminals are only supported on Linux")
+}
+
+func (p *PTY) Close() error {
+	return nil
+}
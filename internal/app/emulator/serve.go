@@ -0,0 +1,40 @@
+package emulator
+
+import (
+	"io"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// Serve reads framed requests from rw and writes the responses back until
+// rw returns an error.
+func (vp *VirtualPrinter) Serve(rw io.ReadWriter) error {
+	buffer := make([]byte, 1024)
+	framer := packets.NewFramer()
+
+	for {
+		n, err := rw.Read(buffer)
+		if err != nil {
+			return err
+		}
+		framer.Write(buffer[:n])
+
+		for {
+			pkt, err := framer.Next()
+			if err != nil {
+				// The printer ignores corrupted frames
+				logger.LogDebug("Virtual printer dropped a frame", err)
+				continue
+			}
+			if pkt == nil {
+				break
+			}
+			for _, response := range vp.Handle(*pkt) {
+				if _, err := rw.Write(response.ToBytes()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package emulator
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var ErrClosed = errors.New("Virtual printer transport is closed")
+
+// Transport connects a NiimbotPrinter to a VirtualPrinter in the same process.
+type Transport struct {
+	Printer     *VirtualPrinter
+	ReadTimeout time.Duration
+
+	mu     sync.Mutex
+	queue  []packets.NiimbotPacket
+	notify chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func NewTransport(printer *VirtualPrinter) *Transport {
+	return &Transport{
+		Printer:     printer,
+		ReadTimeout: 200 * time.Millisecond,
+
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (t *Transport) SendPacket(pkt *packets.NiimbotPacket) error {
+	if t.isClosed() {
+		return ErrClosed
+	}
+	responses := t.Printer.Handle(*pkt)
+	if len(responses) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.queue = append(t.queue, responses...)
+	t.mu.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (t *Transport) ReceivePacket() (*packets.NiimbotPacket, error) {
+	if pkt, err := t.pop(); pkt != nil || err != nil {
+		return pkt, err
+	}
+
+	timer := time.NewTimer(t.ReadTimeout)
+	defer timer.Stop()
+	select {
+	case <-t.notify:
+	case <-timer.C:
+	case <-t.done:
+	}
+	return t.pop()
+}
+
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	return nil
+}
+
+func (t *Transport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+func (t *Transport) pop() (*packets.NiimbotPacket, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	if len(t.queue) == 0 {
+		return nil, nil
+	}
+	pkt := t.queue[0]
+	t.queue = t.queue[1:]
+	return &pkt, nil
+}
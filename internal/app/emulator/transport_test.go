@@ -0,0 +1,171 @@
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+	"time"
+
+	image_encoder "github.com/matheustavarestrindade/niimprintgo/internal/app/image"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// recordingTransport keeps every packet sent through Transport.
+type recordingTransport struct {
+	*Transport
+
+	mu   sync.Mutex
+	sent []packets.NiimbotPacket
+}
+
+func (r *recordingTransport) SendPacket(pkt *packets.NiimbotPacket) error {
+	r.mu.Lock()
+	r.sent = append(r.sent, packets.NiimbotPacket{Type: pkt.Type, Data: append([]byte(nil), pkt.Data...)})
+	r.mu.Unlock()
+	return r.Transport.SendPacket(pkt)
+}
+
+func (r *recordingTransport) packets() []packets.NiimbotPacket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]packets.NiimbotPacket(nil), r.sent...)
+}
+
+// testLabel draws blank rows, a run of identical rows, rows with a few dots
+// and dense rows, so every kind of image row is sent.
+func testLabel(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ink := false
+			switch {
+			case y < 4:
+			case y < 20:
+				ink = x%2 == 0
+			case y < 30:
+				ink = x == y || x == width-1
+			default:
+				ink = (x+y)%3 == 0
+			}
+			if ink {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestPrintLabelThroughTransport(t *testing.T) {
+	models := []struct {
+		name       string
+		deviceType int
+	}{
+		{"D11", 512},
+		{"B1", 4096},
+	}
+
+	for _, model := range models {
+		t.Run(model.name, func(t *testing.T) {
+			virtual := NewVirtualPrinter("")
+			virtual.DeviceType = model.deviceType
+			transport := &recordingTransport{Transport: NewTransport(virtual)}
+			printer := niimbot.NewNiimbotPrinterWithTransport(transport)
+			defer printer.Close()
+
+			img := testLabel(96, 40)
+			options := niimbot.DefaultPrintOptions()
+			options.Quantity = 2
+			options.Image.Rotation = image_encoder.Rotate0
+			options.Image.Fit = image_encoder.FitNone
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := printer.PrintLabelWithOptions(ctx, img, options); err != nil {
+				t.Fatal(err)
+			}
+
+			want := image_encoder.Binarize(img, options.Image)
+			wantRows := image_encoder.EncodeBitmap(want)
+
+			var rows []packets.Request
+			kinds := map[int]bool{}
+			endPrint := -1
+			sent := transport.packets()
+			for i := range sent {
+				pkt := sent[i]
+				switch int(pkt.Type) {
+				case packets.NiimbotD11RequestCodePacket.SET_IMAGE,
+					packets.NiimbotD11RequestCodePacket.SET_IMAGE_DATA,
+					packets.NiimbotD11RequestCodePacket.IMAGE_CLEAR:
+					row, err := packets.ParseImageRow(&pkt, want.Width)
+					if err != nil {
+						t.Fatalf("packet %d: %v", i, err)
+					}
+					rows = append(rows, row)
+					kinds[int(pkt.Type)] = true
+				case packets.NiimbotD11RequestCodePacket.END_PRINT:
+					endPrint = i
+				}
+			}
+
+			if len(rows) != len(wantRows) {
+				t.Fatalf("emulator got %d rows, want %d", len(rows), len(wantRows))
+			}
+			for i, row := range rows {
+				got, err := packets.RequestPacket(row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantPkt, err := packets.RequestPacket(wantRows[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Type != wantPkt.Type || !bytes.Equal(got.Data, wantPkt.Data) {
+					t.Errorf("row %d is %s, want %s", i, got.ToString(), wantPkt.ToString())
+				}
+			}
+			for _, code := range []int{
+				packets.NiimbotD11RequestCodePacket.SET_IMAGE,
+				packets.NiimbotD11RequestCodePacket.SET_IMAGE_DATA,
+				packets.NiimbotD11RequestCodePacket.IMAGE_CLEAR,
+			} {
+				if !kinds[code] {
+					t.Errorf("no row was sent as request %d", code)
+				}
+			}
+			if endPrint != len(sent)-1 {
+				t.Errorf("END_PRINT is packet %d of %d, want the last", endPrint, len(sent))
+			}
+
+			decoded, err := image_encoder.DecodeRows(rows, want.Width, want.Height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded.Pix, want.Pix) {
+				t.Error("rows sent do not decode to the encoded bitmap")
+			}
+
+			labels := virtual.Labels()
+			if len(labels) != 1 {
+				t.Fatalf("emulator rendered %d labels, want 1", len(labels))
+			}
+			if labels[0].Bounds() != want.Bounds() {
+				t.Fatalf("label is %v, want %v", labels[0].Bounds(), want.Bounds())
+			}
+			for y := 0; y < want.Height; y++ {
+				for x := 0; x < want.Width; x++ {
+					gray := color.GrayModel.Convert(labels[0].At(x, y)).(color.Gray)
+					if (gray.Y == 0) != want.Get(x, y) {
+						t.Fatalf("label pixel %d,%d differs from the bitmap", x, y)
+					}
+				}
+			}
+		})
+	}
+}
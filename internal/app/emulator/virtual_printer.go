@@ -0,0 +1,346 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/helpers"
+	image_encoder "github.com/matheustavarestrindade/niimprintgo/internal/app/image"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// Roll is the RFID tag of an emulated label roll.
+type Roll struct {
+	UUID        [8]byte
+	Barcode     string
+	Serial      string
+	TotalLength int
+	UsedLength  int
+	LabelType   int
+}
+
+func (r *Roll) marshal() ([]byte, error) {
+	total, err := helpers.ShortToByteArray(r.TotalLength)
+	if err != nil {
+		return nil, fmt.Errorf("Roll total length %d: %w", r.TotalLength, err)
+	}
+	used, err := helpers.ShortToByteArray(r.UsedLength)
+	if err != nil {
+		return nil, fmt.Errorf("Roll used length %d: %w", r.UsedLength, err)
+	}
+
+	data := append([]byte{}, r.UUID[:]...)
+	data = append(data, byte(len(r.Barcode)))
+	data = append(data, r.Barcode...)
+	data = append(data, byte(len(r.Serial)))
+	data = append(data, r.Serial...)
+	data = append(data, total...)
+	data = append(data, used...)
+	return append(data, byte(r.LabelType)), nil
+}
+
+// VirtualPrinter is a software printer that answers request packets the way
+// the real one does and renders every printed page to a PNG file. It behaves
+// like the model whose profile matches DeviceType, a D11 by default.
+type VirtualPrinter struct {
+	OutputDir   string
+	DeviceType  int
+	Serial      []byte
+	SoftVersion int
+	HardVersion int
+	Battery     int
+	LidOpen     bool
+	PaperOut    bool
+	// Roll is the loaded label roll, nil when it has no RFID tag
+	Roll *Roll
+
+	mu           sync.Mutex
+	labelType    int
+	density      int
+	autoShutdown int
+	quantity     int
+	width        int
+	height       int
+	page         *image_encoder.Bitmap
+	rowsReceived int
+	confirmed    bool
+	labels       []image.Image
+}
+
+func NewVirtualPrinter(outputDir string) *VirtualPrinter {
+	return &VirtualPrinter{
+		OutputDir:   outputDir,
+		DeviceType:  512,
+		Serial:      []byte{0xD1, 0x1E, 0x00, 0x00, 0x00, 0x01},
+		SoftVersion: 105,
+		HardVersion: 102,
+		Battery:     4,
+
+		labelType:    1,
+		density:      2,
+		autoShutdown: 4,
+		quantity:     1,
+	}
+}
+
+// Labels returns every page rendered since the printer was created.
+func (vp *VirtualPrinter) Labels() []image.Image {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	return append([]image.Image(nil), vp.labels...)
+}
+
+// Handle processes one request packet and returns the packets the printer
+// sends back, in order.
+func (vp *VirtualPrinter) Handle(pkt packets.NiimbotPacket) []packets.NiimbotPacket {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+
+	codes := packets.NiimbotD11RequestCodePacket
+	code := int(pkt.Type)
+	profile := vp.Profile()
+	logger.LogDebug("Virtual printer received", pkt.ToString())
+
+	switch code {
+	case codes.SET_LABEL_TYPE:
+		if len(pkt.Data) != 1 || profile.ValidLabelType(int(pkt.Data[0])) != nil {
+			return illegalArgument(code)
+		}
+		vp.labelType = int(pkt.Data[0])
+		return confirm(packets.SetLabelType{})
+	case codes.SET_LABEL_DENSITY:
+		if len(pkt.Data) != 1 || profile.ValidDensity(int(pkt.Data[0])) != nil {
+			return illegalArgument(code)
+		}
+		vp.density = int(pkt.Data[0])
+		return confirm(packets.SetLabelDensity{})
+	case codes.SET_AUTO_SHUTDOWN:
+		if len(pkt.Data) != 1 || profile.ValidAutoShutdown(int(pkt.Data[0])) != nil {
+			return illegalArgument(code)
+		}
+		vp.autoShutdown = int(pkt.Data[0])
+		return confirm(packets.SetAutoShutdown{})
+	case codes.START_PRINT:
+		if len(pkt.Data) != startPrintLength(profile) {
+			return illegalArgument(code)
+		}
+		return confirm(packets.StartPrint{})
+	case codes.END_PRINT:
+		return confirm(packets.EndPrint{})
+	case codes.ALLOW_PRINT_CLEAR:
+		return confirm(packets.AllowPrintClear{})
+	case codes.START_PAGE_PRINT:
+		vp.width, vp.height = 0, 0
+		vp.page = nil
+		vp.rowsReceived = 0
+		vp.confirmed = false
+		return confirm(packets.StartPagePrint{})
+	case codes.SET_DIMENSION:
+		if len(pkt.Data) != dimensionLength(profile) {
+			return illegalArgument(code)
+		}
+		vp.height = int(pkt.Data[0])<<8 | int(pkt.Data[1])
+		vp.width = int(pkt.Data[2])<<8 | int(pkt.Data[3])
+		if vp.width > profile.PrintheadDots || vp.height > profile.MaxLength {
+			return illegalArgument(code)
+		}
+		if profile.Quirks.DimensionWithQuantity {
+			vp.quantity = int(pkt.Data[4])<<8 | int(pkt.Data[5])
+		}
+		vp.page = image_encoder.NewBitmap(vp.width, vp.height)
+		return confirm(packets.SetDimension{})
+	case codes.SET_QUANTITY:
+		if len(pkt.Data) != 2 {
+			return illegalArgument(code)
+		}
+		vp.quantity = int(pkt.Data[0])<<8 | int(pkt.Data[1])
+		return confirm(packets.SetQuantity{})
+	case codes.SET_IMAGE, codes.SET_IMAGE_DATA, codes.IMAGE_CLEAR:
+		if !vp.receiveRow(pkt) {
+			return illegalArgument(code)
+		}
+		if vp.rowsReceived >= vp.height && !vp.confirmed {
+			vp.confirmed = true
+			return confirm(packets.SetImage{})
+		}
+		return nil
+	case codes.END_PAGE_PRINT:
+		if vp.page == nil {
+			return illegalArgument(code)
+		}
+		responses := confirm(packets.EndPagePrint{})
+		vp.renderPage()
+		if vp.Roll != nil {
+			vp.Roll.UsedLength += vp.quantity
+		}
+		for page := 1; page <= vp.quantity; page++ {
+			done := packets.PagePrintDone{Page: page}
+			data, err := done.Marshal()
+			if err != nil {
+				return illegalArgument(code)
+			}
+			responses = append(responses, packets.NiimbotPacket{Type: byte(done.Code()), Data: data})
+		}
+		return responses
+	case codes.GET_INFO:
+		if len(pkt.Data) != 1 {
+			return illegalArgument(code)
+		}
+		req := packets.GetInfo{Key: int(pkt.Data[0])}
+		data := vp.info(req.Key)
+		if data == nil {
+			return illegalArgument(code)
+		}
+		return []packets.NiimbotPacket{{Type: byte(req.ResponseCode()), Data: data}}
+	case codes.GET_RFID:
+		responseCode := byte(packets.GetRFID{}.ResponseCode())
+		if vp.Roll == nil {
+			return []packets.NiimbotPacket{{Type: responseCode, Data: []byte{0}}}
+		}
+		data, err := vp.Roll.marshal()
+		if err != nil {
+			logger.LogDebug("Virtual printer cannot send its roll", err)
+			return illegalArgument(code)
+		}
+		return []packets.NiimbotPacket{{Type: responseCode, Data: data}}
+	case codes.HEARTBEAT:
+		// Lid state, battery level, paper state and RFID state at the end
+		data := make([]byte, 13)
+		if vp.LidOpen {
+			data[9] = 1
+		}
+		data[10] = byte(vp.Battery)
+		if vp.PaperOut {
+			data[11] = 1
+		}
+		if vp.Roll != nil {
+			data[12] = 1
+		}
+		return []packets.NiimbotPacket{{Type: byte(packets.Heartbeat{}.ResponseCode()), Data: data}}
+	}
+
+	logger.LogDebug("Virtual printer does not implement code", code)
+	return []packets.NiimbotPacket{{Type: byte(packets.NiimbotD11ResponseCodePacket.NOT_IMPLEMENT), Data: []byte{byte(code)}}}
+}
+
+// Profile returns the profile of the emulated model.
+func (vp *VirtualPrinter) Profile() *niimbot.Profile {
+	if profile, ok := niimbot.ProfileForDeviceType(vp.DeviceType); ok {
+		return profile
+	}
+	return niimbot.DefaultProfile
+}
+
+// startPrintLength and dimensionLength are the payload sizes the model's
+// quirks call for.
+func startPrintLength(profile *niimbot.Profile) int {
+	if profile.Quirks.PrintStartWithPages {
+		return 7
+	}
+	return 1
+}
+
+func dimensionLength(profile *niimbot.Profile) int {
+	if profile.Quirks.DimensionWithQuantity {
+		return 6
+	}
+	return 4
+}
+
+// info returns the value of an info key, nil when the printer has none.
+func (vp *VirtualPrinter) info(key int) []byte {
+	keys := packets.NiimbotD11InfoPacket
+	switch key {
+	case keys.DENSITY:
+		return []byte{byte(vp.density)}
+	case keys.PRINTSPEED:
+		return []byte{1}
+	case keys.LABELTYPE:
+		return []byte{byte(vp.labelType)}
+	case keys.LANGUAGETYPE:
+		return []byte{1}
+	case keys.AUTOSHUTDOWNTIME:
+		return []byte{byte(vp.autoShutdown)}
+	case keys.DEVICETYPE:
+		return short(vp.DeviceType)
+	case keys.SOFTVERSION:
+		return short(vp.SoftVersion)
+	case keys.BATTERY:
+		return []byte{byte(vp.Battery)}
+	case keys.DEVICESERIAL:
+		return vp.Serial
+	case keys.HARDVERSION:
+		return short(vp.HardVersion)
+	}
+	return nil
+}
+
+// receiveRow draws an image row on the page SET_DIMENSION sized, rejecting
+// rows the printer could not print.
+func (vp *VirtualPrinter) receiveRow(pkt packets.NiimbotPacket) bool {
+	if vp.page == nil {
+		logger.LogDebug("Virtual printer received a row before SET_DIMENSION")
+		return false
+	}
+	row, err := packets.ParseImageRow(&pkt, vp.width)
+	if err == nil {
+		err = vp.page.DrawRow(row)
+	}
+	if err != nil {
+		logger.LogDebug("Virtual printer received an invalid row", err)
+		return false
+	}
+
+	y, n := row.Span()
+	if y+n > vp.rowsReceived {
+		vp.rowsReceived = y + n
+	}
+	return true
+}
+
+func (vp *VirtualPrinter) renderPage() {
+	img := image.NewGray(vp.page.Bounds())
+	draw.Draw(img, img.Bounds(), vp.page, image.Point{}, draw.Src)
+	vp.labels = append(vp.labels, img)
+
+	if vp.OutputDir == "" {
+		return
+	}
+	path := filepath.Join(vp.OutputDir, fmt.Sprintf("label-%04d.png", len(vp.labels)))
+	file, err := os.Create(path)
+	if err != nil {
+		logger.LogError("Error creating label file", path)
+		return
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		logger.LogError("Error writing label file", path)
+		return
+	}
+	logger.LogInfo("Virtual printer rendered label to", path)
+}
+
+// short encodes a configured value, nil when it does not fit in 16 bits.
+func short(value int) []byte {
+	data, err := helpers.ShortToByteArray(value)
+	if err != nil {
+		logger.LogDebug("Virtual printer value does not fit in 16 bits", value)
+		return nil
+	}
+	return data
+}
+
+func confirm(req packets.Request) []packets.NiimbotPacket {
+	return []packets.NiimbotPacket{{Type: byte(req.ResponseCode()), Data: packets.Confirmation{OK: true}.Marshal()}}
+}
+
+func illegalArgument(code int) []packets.NiimbotPacket {
+	return []packets.NiimbotPacket{{Type: byte(packets.NiimbotD11ResponseCodePacket.ILLEGAL_ARGUMENT), Data: []byte{byte(code)}}}
+}
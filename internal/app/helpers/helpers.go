@@ -1,17 +1,33 @@
 package helpers
 
 import (
+	"errors"
 	"image"
 	"os"
 
+	// Decoders for GetImageFromFilePath
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
 )
 
-func ShortToByteArray(short int) []byte {
-	if short < 0 || short > 65535 {
-		panic("Short out of range")
+var ErrNotShort = errors.New("Value does not fit in 16 bits")
+
+// ShortToByteArray encodes short big endian, failing when it does not fit.
+func ShortToByteArray(short int) ([]byte, error) {
+	if !ValidShort(short) {
+		return nil, ErrNotShort
 	}
-	return []byte{byte(short / 256), byte(short % 256)}
+	return []byte{byte(short >> 8), byte(short)}, nil
+}
+
+func ValidShort(short int) bool {
+	return short >= 0 && short <= 65535
 }
 
 func GetImageFromFilePath(path string) image.Image {
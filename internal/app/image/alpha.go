@@ -0,0 +1,89 @@
+package image_encoder
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+var (
+	ErrUnknownAlphaMode = errors.New("Unknown alpha mode")
+	ErrInvalidColor     = errors.New("Invalid color")
+)
+
+// AlphaMode decides how transparent pixels are printed.
+type AlphaMode string
+
+const (
+	// AlphaBackground composites pixels onto Options.Background
+	AlphaBackground AlphaMode = "background"
+	// AlphaInk prints by opacity alone, ignoring the color
+	AlphaInk AlphaMode = "ink"
+)
+
+var AlphaModes = []AlphaMode{AlphaBackground, AlphaInk}
+
+func ParseAlphaMode(name string) (AlphaMode, error) {
+	for _, mode := range AlphaModes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownAlphaMode, name)
+}
+
+// ParseColor reads white, black or a hex color such as #ffcc00 or #fc0.
+func ParseColor(name string) (color.Color, error) {
+	switch name {
+	case "white":
+		return color.White, nil
+	case "black":
+		return color.Black, nil
+	}
+
+	digits := strings.TrimPrefix(name, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	rgb, err := hex.DecodeString(digits)
+	if err != nil || len(rgb) != 3 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidColor, name)
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, nil
+}
+
+// compositor removes transparency as Options.Alpha says, with the
+// background read once per image.
+type compositor struct {
+	ink        bool
+	br, bg, bb uint32
+}
+
+func newCompositor(options Options) compositor {
+	background := options.Background
+	if background == nil {
+		background = color.White
+	}
+	br, bg, bb, _ := background.RGBA()
+	return compositor{ink: options.Alpha == AlphaInk, br: br, bg: bg, bb: bb}
+}
+
+// luminance returns the luminance of a pixel, given as premultiplied 16 bit
+// channels like color.Color.RGBA, once its transparency is removed. It is
+// weighed the way the eye does (ITU-R BT.601) and rounded, from 0 for black
+// to 255 for white.
+func (c compositor) luminance(r, g, b, a uint32) uint8 {
+	if c.ink {
+		return uint8((0xffff - a + 128) / 257)
+	}
+	if a != 0xffff {
+		// The background shows through the rest
+		t := 0xffff - a
+		r += c.br * t / 0xffff
+		g += c.bg * t / 0xffff
+		b += c.bb * t / 0xffff
+	}
+	return uint8((0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257 + 0.5)
+}
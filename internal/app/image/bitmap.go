@@ -0,0 +1,106 @@
+package image_encoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// Bitmap is a 1-bit image, 1 being ink. Rows are packed eight pixels to a
+// byte, most significant bit first and padded to whole bytes, which is the
+// layout SET_IMAGE_DATA sends.
+type Bitmap struct {
+	Width  int
+	Height int
+	// Stride is the number of bytes in a row
+	Stride int
+	Pix    []byte
+}
+
+func NewBitmap(width, height int) *Bitmap {
+	stride := (width + 7) / 8
+	return &Bitmap{
+		Width:  width,
+		Height: height,
+		Stride: stride,
+		Pix:    make([]byte, stride*height),
+	}
+}
+
+func (b *Bitmap) Set(x, y int, ink bool) {
+	if x < 0 || x >= b.Width || y < 0 || y >= b.Height {
+		return
+	}
+	mask := byte(0x80) >> (x % 8)
+	if ink {
+		b.Pix[y*b.Stride+x/8] |= mask
+	} else {
+		b.Pix[y*b.Stride+x/8] &^= mask
+	}
+}
+
+func (b *Bitmap) Get(x, y int) bool {
+	if x < 0 || x >= b.Width || y < 0 || y >= b.Height {
+		return false
+	}
+	return b.Pix[y*b.Stride+x/8]&(0x80>>(x%8)) != 0
+}
+
+// Row returns the packed bytes of row y, sharing the bitmap's memory.
+func (b *Bitmap) Row(y int) []byte {
+	return b.Pix[y*b.Stride : (y+1)*b.Stride]
+}
+
+// FNV-1a parameters, hashed inline as hash/fnv would allocate a hasher per
+// row.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// RowHash returns the FNV-1a hash of row y, so runs of identical rows can
+// be found without comparing every byte.
+func (b *Bitmap) RowHash(y int) uint64 {
+	hash := uint64(fnvOffset64)
+	for _, c := range b.Row(y) {
+		hash ^= uint64(c)
+		hash *= fnvPrime64
+	}
+	return hash
+}
+
+func (b *Bitmap) RowEqual(y1, y2 int) bool {
+	return bytes.Equal(b.Row(y1), b.Row(y2))
+}
+
+// InkCount returns the number of ink pixels of row y in [from, to), both
+// multiples of 8.
+func (b *Bitmap) InkCount(y, from, to int) int {
+	return inkCount(b.Row(y), from, to)
+}
+
+func inkCount(row []byte, from, to int) int {
+	count := 0
+	for i := from / 8; i < to/8 && i < len(row); i++ {
+		count += bits.OnesCount8(row[i])
+	}
+	return count
+}
+
+// Bitmap is an image.Image as well, for previews and PNG output.
+
+func (b *Bitmap) ColorModel() color.Model {
+	return color.GrayModel
+}
+
+func (b *Bitmap) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.Width, b.Height)
+}
+
+func (b *Bitmap) At(x, y int) color.Color {
+	if b.Get(x, y) {
+		return color.Black
+	}
+	return color.White
+}
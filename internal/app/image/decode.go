@@ -0,0 +1,97 @@
+package image_encoder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var ErrInvalidRow = errors.New("Invalid image row")
+
+// DecodeRows rebuilds the bitmap that image rows such as those of
+// EncodeBitmap draw on a width x height label. A height of 0 ends the
+// bitmap at the last row drawn. Rows not drawn stay blank.
+func DecodeRows(rows []packets.Request, width, height int) (*Bitmap, error) {
+	if height == 0 {
+		for _, req := range rows {
+			imageRow, ok := req.(packets.ImageRow)
+			if !ok {
+				return nil, fmt.Errorf("%w: request %d", ErrInvalidRow, req.Code())
+			}
+			row, repeat := imageRow.Span()
+			height = max(height, row+repeat)
+		}
+	}
+
+	bitmap := NewBitmap(width, height)
+	for _, req := range rows {
+		if err := bitmap.DrawRow(req); err != nil {
+			return nil, err
+		}
+	}
+	return bitmap, nil
+}
+
+// DrawRow draws an image row request on b, replacing what earlier rows drew
+// there. The row is checked the way the printer reads it: it must lie on
+// the label, its ink counts must match its pixels and its bitmap must be as
+// wide as the label. b is left as it was when the row is rejected.
+func (b *Bitmap) DrawRow(req packets.Request) error {
+	imageRow, ok := req.(packets.ImageRow)
+	if !ok {
+		return fmt.Errorf("%w: request %d", ErrInvalidRow, req.Code())
+	}
+	row, repeat := imageRow.Span()
+	if row < 0 || repeat < 1 || row+repeat > b.Height {
+		return fmt.Errorf("%w: rows %d to %d outside of a %d rows label", ErrInvalidRow, row, row+repeat-1, b.Height)
+	}
+
+	line := make([]byte, b.Stride)
+	var counts []byte
+	switch r := req.(type) {
+	case packets.SetImage:
+		counts = r.Counts
+		for _, x := range r.Indexes {
+			if x < 0 || x >= b.Width {
+				return fmt.Errorf("%w: row %d pixel %d outside of a %d dots label", ErrInvalidRow, row, x, b.Width)
+			}
+			line[x/8] |= 0x80 >> (x % 8)
+		}
+	case packets.SetImageData:
+		counts = r.Counts
+		if len(r.Bitmap) != b.Stride {
+			return fmt.Errorf("%w: row %d has %d bytes for %d dots", ErrInvalidRow, row, len(r.Bitmap), b.Width)
+		}
+		copy(line, r.Bitmap)
+		// Bits past the label width are padding
+		if b.Width%8 != 0 {
+			line[len(line)-1] &= 0xff << (8 - b.Width%8)
+		}
+	}
+
+	// Cleared rows send no counts
+	if _, cleared := req.(packets.ImageClear); !cleared {
+		if err := checkCounts(line, b.Width, row, counts); err != nil {
+			return err
+		}
+	}
+	for y := row; y < row+repeat; y++ {
+		copy(b.Row(y), line)
+	}
+	return nil
+}
+
+// checkCounts compares the ink counts sent with a row, one per 32 dots, to
+// the pixels it drew.
+func checkCounts(line []byte, width, row int, counts []byte) error {
+	if len(counts) != (width+31)/32 {
+		return fmt.Errorf("%w: row %d has %d ink counts for %d dots", ErrInvalidRow, row, len(counts), width)
+	}
+	for i, count := range counts {
+		if ink := inkCount(line, i*32, (i+1)*32); ink != int(count) {
+			return fmt.Errorf("%w: row %d counts %d ink pixels at %d, found %d", ErrInvalidRow, row, count, i*32, ink)
+		}
+	}
+	return nil
+}
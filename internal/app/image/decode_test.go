@@ -0,0 +1,141 @@
+package image_encoder
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// roundTrip encodes bitmap, marshals every row to its packet, parses the
+// packets back the way the printer reads them and decodes the result.
+func roundTrip(t *testing.T, bitmap *Bitmap) ([]packets.Request, *Bitmap) {
+	t.Helper()
+	rows := EncodeBitmap(bitmap)
+	parsed := make([]packets.Request, 0, len(rows))
+	for _, req := range rows {
+		pkt, err := packets.RequestPacket(req)
+		if err != nil {
+			t.Fatalf("marshalling %T: %v", req, err)
+		}
+		row, err := packets.ParseImageRow(&pkt, bitmap.Width)
+		if err != nil {
+			t.Fatalf("parsing %T: %v", req, err)
+		}
+		parsed = append(parsed, row)
+	}
+	decoded, err := DecodeRows(parsed, bitmap.Width, bitmap.Height)
+	if err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	return rows, decoded
+}
+
+func TestDecodeRowsRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	widths := []int{1, 7, 13, 31, 33, 50, 96, 100, 120, 384}
+
+	for _, width := range widths {
+		bitmap := NewBitmap(width, 300)
+		for y := 0; y < bitmap.Height; y++ {
+			// Runs of identical rows, some of them long
+			if y > 0 && random.Intn(4) != 0 {
+				copy(bitmap.Row(y), bitmap.Row(y-1))
+				continue
+			}
+			density := random.Float64() * 0.5
+			for x := 0; x < width; x++ {
+				bitmap.Set(x, y, random.Float64() < density)
+			}
+		}
+
+		_, decoded := roundTrip(t, bitmap)
+		if !bytes.Equal(decoded.Pix, bitmap.Pix) {
+			t.Errorf("width %d: decoded bitmap differs from the encoded one", width)
+		}
+	}
+}
+
+func TestDecodeRowsSliceBoundary(t *testing.T) {
+	// One run across two slice boundaries, then a different last row
+	bitmap := NewBitmap(96, 2*sliceSize+51)
+	for y := 0; y < bitmap.Height-1; y++ {
+		fillRow(bitmap, y, 2)
+	}
+	fillRow(bitmap, bitmap.Height-1, 3)
+
+	rows, decoded := roundTrip(t, bitmap)
+	want := [][2]int{{0, sliceSize}, {sliceSize, sliceSize}, {2 * sliceSize, 50}, {2*sliceSize + 50, 1}}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, req := range rows {
+		row, repeat := req.(packets.ImageRow).Span()
+		if row != want[i][0] || repeat != want[i][1] {
+			t.Errorf("row %d spans %d+%d, want %d+%d", i, row, repeat, want[i][0], want[i][1])
+		}
+	}
+	if !bytes.Equal(decoded.Pix, bitmap.Pix) {
+		t.Error("decoded bitmap differs from the encoded one")
+	}
+}
+
+func TestDecodeRowsSparseRows(t *testing.T) {
+	bitmap := NewBitmap(100, 3)
+	bitmap.Set(0, 0, true)
+	bitmap.Set(99, 0, true)
+	bitmap.Set(45, 2, true)
+
+	rows, decoded := roundTrip(t, bitmap)
+	wantTypes := []packets.Request{packets.SetImage{}, packets.ImageClear{}, packets.SetImage{}}
+	for i, req := range rows {
+		if req.Code() != wantTypes[i].Code() {
+			t.Errorf("row %d is %T, want %T", i, req, wantTypes[i])
+		}
+	}
+	if !bytes.Equal(decoded.Pix, bitmap.Pix) {
+		t.Error("decoded bitmap differs from the encoded one")
+	}
+}
+
+func TestDecodeRowsRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		row  packets.Request
+	}{
+		{"bad counts", packets.SetImage{Row: 0, Counts: []byte{2, 0, 0}, Repeat: 1, Indexes: []int{3}}},
+		{"counts in the wrong chunk", packets.SetImage{Row: 0, Counts: []byte{0, 1, 0}, Repeat: 1, Indexes: []int{3}}},
+		{"missing counts", packets.SetImage{Row: 0, Counts: []byte{1}, Repeat: 1, Indexes: []int{3}}},
+		{"pixel past the width", packets.SetImage{Row: 0, Counts: []byte{0, 0, 0}, Repeat: 1, Indexes: []int{96}}},
+		{"row past the height", packets.ImageClear{Row: 4, Repeat: 1}},
+		{"repeat past the height", packets.ImageClear{Row: 2, Repeat: 3}},
+		{"no repeat", packets.ImageClear{Row: 0, Repeat: 0}},
+		{"short bitmap", packets.SetImageData{Row: 0, Counts: []byte{0, 0, 0}, Repeat: 1, Bitmap: make([]byte, 11)}},
+		{"not a row", packets.Heartbeat{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeRows([]packets.Request{test.row}, 96, 4)
+			if !errors.Is(err, ErrInvalidRow) {
+				t.Errorf("got %v, want ErrInvalidRow", err)
+			}
+		})
+	}
+}
+
+func TestDrawRowKeepsBitmapOnError(t *testing.T) {
+	bitmap := NewBitmap(96, 2)
+	fillRow(bitmap, 0, 2)
+	before := append([]byte(nil), bitmap.Pix...)
+
+	bad := packets.SetImage{Row: 0, Counts: []byte{5, 0, 0}, Repeat: 2, Indexes: []int{3}}
+	if err := bitmap.DrawRow(bad); err == nil {
+		t.Fatal("bad counts were accepted")
+	}
+	if !bytes.Equal(bitmap.Pix, before) {
+		t.Error("a rejected row changed the bitmap")
+	}
+}
@@ -0,0 +1,148 @@
+package image_encoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownDither = errors.New("Unknown dithering algorithm")
+
+type Dither string
+
+const (
+	DitherThreshold      Dither = "threshold"
+	DitherFloydSteinberg Dither = "floyd-steinberg"
+	DitherAtkinson       Dither = "atkinson"
+	DitherStucki         Dither = "stucki"
+	DitherBayer4         Dither = "bayer4"
+	DitherBayer8         Dither = "bayer8"
+)
+
+var Dithers = []Dither{DitherThreshold, DitherFloydSteinberg, DitherAtkinson, DitherStucki, DitherBayer4, DitherBayer8}
+
+func ParseDither(name string) (Dither, error) {
+	for _, dither := range Dithers {
+		if string(dither) == name {
+			return dither, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownDither, name)
+}
+
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+// Error diffusion kernels, each spreading the error of a pixel over the
+// neighbours not visited yet.
+var diffusionKernels = map[Dither][]diffusion{
+	DitherFloydSteinberg: {
+		{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	},
+	// Atkinson drops a quarter of the error, which keeps highlights clean
+	DitherAtkinson: {
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8},
+	},
+	DitherStucki: {
+		{1, 0, 8.0 / 42}, {2, 0, 4.0 / 42},
+		{-2, 1, 2.0 / 42}, {-1, 1, 4.0 / 42}, {0, 1, 8.0 / 42}, {1, 1, 4.0 / 42}, {2, 1, 2.0 / 42},
+		{-2, 2, 1.0 / 42}, {-1, 2, 2.0 / 42}, {0, 2, 4.0 / 42}, {1, 2, 2.0 / 42}, {2, 2, 1.0 / 42},
+	},
+}
+
+var bayerSizes = map[Dither]int{
+	DitherBayer4: 4,
+	DitherBayer8: 8,
+}
+
+// dither turns a grayscale image, 0 black to 255 white, into a bitmap.
+// level returns the threshold of the pixel at an index of gray.
+func dither(gray []uint8, width, height int, algorithm Dither, level func(i int) float64) *Bitmap {
+	ink := NewBitmap(width, height)
+
+	if kernel, ok := diffusionKernels[algorithm]; ok {
+		// The error diffused to the current row and the ones below it, which
+		// is all error diffusion needs to keep
+		rows := 1
+		for _, k := range kernel {
+			rows = max(rows, k.dy+1)
+		}
+		errs := make([][]float64, rows)
+		for i := range errs {
+			errs[i] = make([]float64, width)
+		}
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				value := float64(gray[y*width+x]) + errs[0][x]
+				target := 255.0
+				if value < level(y*width+x) {
+					ink.Set(x, y, true)
+					target = 0
+				}
+				diffError := value - target
+				for _, k := range kernel {
+					nx := x + k.dx
+					if nx < 0 || nx >= width {
+						continue
+					}
+					errs[k.dy][nx] += diffError * k.weight
+				}
+			}
+			done := errs[0]
+			clear(done)
+			copy(errs, errs[1:])
+			errs[rows-1] = done
+		}
+		return ink
+	}
+
+	if size, ok := bayerSizes[algorithm]; ok {
+		matrix := bayerMatrix(size)
+		cells := float64(size * size)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				cutoff := (float64(matrix[y%size][x%size]) + 0.5) / cells * 255
+				if float64(gray[y*width+x]) < cutoff {
+					ink.Set(x, y, true)
+				}
+			}
+		}
+		return ink
+	}
+
+	for i, value := range gray {
+		if float64(value) < level(i) {
+			ink.Set(i%width, i/width, true)
+		}
+	}
+	return ink
+}
+
+// bayerMatrix builds the size x size ordered dithering matrix, size being a
+// power of two.
+func bayerMatrix(size int) [][]int {
+	matrix := [][]int{{0}}
+	for n := 1; n < size; n *= 2 {
+		next := make([][]int, n*2)
+		for y := range next {
+			next[y] = make([]int, n*2)
+			for x := range next[y] {
+				base := 4 * matrix[y%n][x%n]
+				switch {
+				case y < n && x < n:
+					next[y][x] = base
+				case y < n:
+					next[y][x] = base + 2
+				case x < n:
+					next[y][x] = base + 3
+				default:
+					next[y][x] = base + 1
+				}
+			}
+		}
+		matrix = next
+	}
+	return matrix
+}
@@ -0,0 +1,139 @@
+package image_encoder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+var (
+	ErrUnknownFit    = errors.New("Unknown fit mode")
+	ErrUnknownAlign  = errors.New("Unknown alignment")
+	ErrUnknownFilter = errors.New("Unknown resample filter")
+)
+
+type FitMode string
+
+const (
+	// FitContain scales the image to fit inside the label, keeping its aspect.
+	// Smaller images keep their size unless Options.Upscale is set
+	FitContain FitMode = "contain"
+	// FitCover scales the image to fill the label, cropping what overflows
+	FitCover FitMode = "cover"
+	// FitStretch scales both sides to the label, ignoring the aspect
+	FitStretch FitMode = "stretch"
+	// FitNone keeps the image size, cropping it to the label when larger
+	FitNone FitMode = "none"
+)
+
+type Align string
+
+const (
+	AlignCenter Align = "center"
+	AlignTop    Align = "top"
+	AlignBottom Align = "bottom"
+)
+
+type Filter string
+
+const (
+	FilterNearest    Filter = "nearest"
+	FilterBox        Filter = "box"
+	FilterLinear     Filter = "linear"
+	FilterCatmullRom Filter = "catmull-rom"
+	FilterLanczos    Filter = "lanczos"
+)
+
+var FitModes = []FitMode{FitContain, FitCover, FitStretch, FitNone}
+
+var Aligns = []Align{AlignCenter, AlignTop, AlignBottom}
+
+var resampleFilters = map[Filter]imaging.ResampleFilter{
+	FilterNearest:    imaging.NearestNeighbor,
+	FilterBox:        imaging.Box,
+	FilterLinear:     imaging.Linear,
+	FilterCatmullRom: imaging.CatmullRom,
+	FilterLanczos:    imaging.Lanczos,
+}
+
+func ParseFitMode(name string) (FitMode, error) {
+	for _, mode := range FitModes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownFit, name)
+}
+
+func ParseAlign(name string) (Align, error) {
+	for _, align := range Aligns {
+		if string(align) == name {
+			return align, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownAlign, name)
+}
+
+func ParseFilter(name string) (Filter, error) {
+	if _, ok := resampleFilters[Filter(name)]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownFilter, name)
+	}
+	return Filter(name), nil
+}
+
+// Fit scales img for a width x height label as options.Fit says and pads
+// it with white. Images are always centered across the width, options.Align
+// places them along the length.
+func Fit(img image.Image, width, height int, options Options) image.Image {
+	imgWidth, imgHeight := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || height <= 0 || imgWidth == 0 || imgHeight == 0 {
+		return img
+	}
+
+	scaledWidth, scaledHeight := imgWidth, imgHeight
+	switch options.Fit {
+	case FitContain, FitCover:
+		scale := math.Min(float64(width)/float64(imgWidth), float64(height)/float64(imgHeight))
+		if options.Fit == FitCover {
+			scale = math.Max(float64(width)/float64(imgWidth), float64(height)/float64(imgHeight))
+		} else if !options.Upscale {
+			scale = math.Min(scale, 1)
+		}
+		scaledWidth = max(1, int(math.Round(float64(imgWidth)*scale)))
+		scaledHeight = max(1, int(math.Round(float64(imgHeight)*scale)))
+	case FitStretch:
+		scaledWidth, scaledHeight = width, height
+	}
+
+	scaled := img
+	if scaledWidth != imgWidth || scaledHeight != imgHeight {
+		filter, ok := resampleFilters[options.Filter]
+		if !ok {
+			filter = imaging.Lanczos
+		}
+		scaled = imaging.Resize(img, scaledWidth, scaledHeight, filter)
+	}
+	if scaledWidth == width && scaledHeight == height {
+		return scaled
+	}
+
+	y := (height - scaledHeight) / 2
+	switch options.Align {
+	case AlignTop:
+		y = 0
+	case AlignBottom:
+		y = height - scaledHeight
+	}
+	// Padding prints blank whatever the background. With AlphaInk opaque
+	// white would be ink, so it stays transparent there.
+	var padding color.Color = color.White
+	if options.Alpha == AlphaInk {
+		padding = color.Transparent
+	}
+	canvas := imaging.New(width, height, padding)
+	return imaging.Paste(canvas, scaled, image.Pt((width-scaledWidth)/2, y))
+}
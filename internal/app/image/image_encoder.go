@@ -1,147 +1,121 @@
 package image_encoder
 
 import (
-	"bytes"
 	"image"
-	"image/color"
 
-	"github.com/disintegration/imaging"
-	"github.com/matheustavarestrindade/niimprintgo/internal/app/helpers"
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
 )
 
-func EncodeForPrintingWithConfirmation(img image.Image) []packets.NiimbotPacket {
-	binImg := convertImageToBinary(img)
-
-	niimbotPackets := make([]packets.NiimbotPacket, 0)
-	sliceSize := 200
-
-	imgHeight := img.Bounds().Dy()
-	imgWidth := img.Bounds().Dx()
-
-	for ySlice := 0; ySlice < imgHeight; ySlice += sliceSize {
-
-		hSlice := min(imgHeight, ySlice+sliceSize)
-		minBounds, maxBounds := sliceBounds(ySlice, imgWidth, len(binImg))
+func EncodeForPrintingWithConfirmation(img image.Image) []packets.Request {
+	return EncodeWithOptions(img, DefaultOptions())
+}
 
-		yNext := ySlice
-		dataNext := binImg[minBounds:maxBounds]
+func EncodeWithOptions(img image.Image, options Options) []packets.Request {
+	return EncodeBitmap(convertImageToBinary(img, options))
+}
 
-		for yNext < hSlice {
-			y := yNext
-			data := dataNext
+// sliceSize bounds runs of repeated rows, whose count is sent in a byte.
+const sliceSize = 200
 
-			yNext++
-			for yNext < hSlice {
-				minBounds, maxBounds := sliceBounds(yNext, imgWidth, len(binImg))
-				dataNext = binImg[minBounds:maxBounds]
+// EncodeBitmap turns bitmap into image row requests, sending each run of
+// identical rows once with its repeat count.
+func EncodeBitmap(bitmap *Bitmap) []packets.Request {
+	niimbotPackets := make([]packets.Request, 0)
 
-				yNext++
-				if bytes.Compare(data, dataNext) != 0 {
-					break
-				}
-			}
+	for y := 0; y < bitmap.Height; {
+		end := min(bitmap.Height, (y/sliceSize+1)*sliceSize)
+		hash := bitmap.RowHash(y)
 
-			niimbotPackets = append(niimbotPackets, packetImageData(y, imgWidth, data, yNext-y))
+		repeat := 1
+		for y+repeat < end && bitmap.RowHash(y+repeat) == hash && bitmap.RowEqual(y, y+repeat) {
+			repeat++
 		}
 
+		niimbotPackets = append(niimbotPackets, packetImageData(bitmap, y, repeat))
+		y += repeat
 	}
 	return niimbotPackets
 }
 
-func packetImageData(y, width int, data []byte, n int) packets.NiimbotPacket {
-
-	buffer := new(bytes.Buffer)
-	heightBytes := helpers.ShortToByteArray(y)
-
-	buffer.WriteByte(heightBytes[0])
-	buffer.WriteByte(heightBytes[1])
-
-	indexes := make([]int, 0)
+func packetImageData(bitmap *Bitmap, y, n int) packets.Request {
+	width := bitmap.Width
+	counts := make([]byte, 0, (width+31)/32)
+	total := 0
 	for x := 0; x < width; x += 32 {
-		start_indexes := len(indexes)
-		for b := 0; b < 32; b++ {
-			if len(data) > x+b && data[x+b] != 0 {
-				indexes = append(indexes, x+b)
-			}
-		}
-		buffer.WriteByte(byte(len(indexes) - start_indexes))
-	}
-	buffer.WriteByte(byte(n))
-
-	if len(indexes) == 0 {
-		data := make([]byte, 0)
-		lineBytes := helpers.ShortToByteArray(y)
-		data = append(data, lineBytes[0])
-		data = append(data, lineBytes[1])
-		data = append(data, byte(n))
-
-		return packets.NiimbotPacket{
-			Type: byte(packets.NiimbotD11RequestCodePacket.IMAGE_CLEAR),
-			Data: data,
-		}
+		count := bitmap.InkCount(y, x, x+32)
+		counts = append(counts, byte(count))
+		total += count
 	}
 
-	// If buffer is small, send indexes instead of bitmaps
-	if len(indexes)*2 < width/8 {
-		for _, index := range indexes {
-			indexBytes := helpers.ShortToByteArray(index)
-			buffer.WriteByte(indexBytes[0])
-			buffer.WriteByte(indexBytes[1])
-		}
-		return packets.NiimbotPacket{
-			Type: byte(packets.NiimbotD11RequestCodePacket.SET_IMAGE),
-			Data: buffer.Bytes(),
-		}
+	if total == 0 {
+		return packets.ImageClear{Row: y, Repeat: n}
 	}
 
-	for x := 0; x < width; x += 8 {
-		bits := byte(0)
-		for b := 0; b < 8; b++ {
-			if len(data) > x+b && data[x+b] != 0 {
-				bits |= 1 << (7 - b)
+	// If buffer is small, send indexes instead of bitmaps
+	if total*2 < width/8 {
+		indexes := make([]int, 0, total)
+		for x := 0; x < width; x++ {
+			if bitmap.Get(x, y) {
+				indexes = append(indexes, x)
 			}
 		}
-		buffer.WriteByte(bits)
+		return packets.SetImage{Row: y, Counts: counts, Repeat: n, Indexes: indexes}
 	}
 
-	return packets.NiimbotPacket{
-		Type: byte(packets.NiimbotD11RequestCodePacket.SET_IMAGE_DATA),
-		Data: buffer.Bytes(),
-	}
+	return packets.SetImageData{Row: y, Counts: counts, Repeat: n, Bitmap: bitmap.Row(y)}
+}
+
+// convertImageToBinary binarizes img as options say.
+func convertImageToBinary(img image.Image, options Options) *Bitmap {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	gray := grayLevels(img, newCompositor(options))
+	level := thresholds(gray, width, height, options)
+	return dither(gray, width, height, options.Dither, level)
 }
 
-func convertImageToBinary(img image.Image) []byte {
-	grayscaled := imaging.Grayscale(img)
-	inverted := imaging.Invert(grayscaled)
-	binArray := make([]byte, 0)
-
-	for y := 0; y < img.Bounds().Dy(); y++ {
-		for x := 0; x < img.Bounds().Dx(); x++ {
-			pixel := inverted.At(x, y)
-			isWhite := isWhite(pixel)
-			if isWhite {
-				binArray = append(binArray, 1)
-			} else {
-				binArray = append(binArray, 0)
+// grayLevels returns the luminance of every pixel, row by row. The image
+// types imaging and the PNG decoder produce are read without going through
+// image.At, which allocates a color for each pixel.
+func grayLevels(img image.Image, c compositor) []uint8 {
+	bounds := img.Bounds()
+	gray := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+
+	switch src := img.(type) {
+	case *image.NRGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			pix := src.Pix[src.PixOffset(bounds.Min.X, y):src.PixOffset(bounds.Max.X, y)]
+			for i := 0; i < len(pix); i += 4 {
+				// Premultiplied the way color.NRGBA.RGBA does it
+				a := uint32(pix[i+3]) * 0x101
+				r := uint32(pix[i]) * 0x101 * a / 0xffff
+				g := uint32(pix[i+1]) * 0x101 * a / 0xffff
+				b := uint32(pix[i+2]) * 0x101 * a / 0xffff
+				gray = append(gray, c.luminance(r, g, b, a))
+			}
+		}
+	case *image.Gray:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for _, value := range src.Pix[src.PixOffset(bounds.Min.X, y):src.PixOffset(bounds.Max.X, y)] {
+				v := uint32(value) * 0x101
+				gray = append(gray, c.luminance(v, v, v, 0xffff))
+			}
+		}
+	default:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				gray = append(gray, c.luminance(img.At(x, y).RGBA()))
 			}
 		}
 	}
-
-	return binArray
+	return gray
 }
 
-func sliceBounds(ySlice, imgWidth, dataLength int) (int, int) {
-	min := (ySlice * imgWidth)
-	max := (ySlice + 1) * imgWidth
-
-	if min >= dataLength {
-		return dataLength, dataLength
-	}
-	if max > dataLength {
-		max = dataLength
-	}
-	return min, max
+// Binarize returns img as it prints.
+func Binarize(img image.Image, options Options) *Bitmap {
+	return convertImageToBinary(img, options)
 }
 
 func min(a, b int) int {
@@ -150,14 +124,3 @@ func min(a, b int) int {
 	}
 	return b
 }
-
-func isWhite(pixel color.Color) bool {
-	// get pixels between 0 to 255
-	r, g, b, _ := pixel.RGBA()
-
-	r = r >> 8
-	g = g >> 8
-	b = b >> 8
-
-	return r > 128 && g > 128 && b > 128
-}
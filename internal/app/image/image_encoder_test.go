@@ -0,0 +1,76 @@
+package image_encoder
+
+import (
+	"bytes"
+	"hash/fnv"
+	"testing"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// fillRow inks every pixel of row y whose x is a multiple of step, dense
+// enough to be sent as SET_IMAGE_DATA.
+func fillRow(bitmap *Bitmap, y, step int) {
+	for x := 0; x < bitmap.Width; x += step {
+		bitmap.Set(x, y, true)
+	}
+}
+
+// The encoder used to count the first differing row into the run before it,
+// so A,A,B went out as A repeated 3 times and B was lost, and every row after
+// a run was sent one row too low.
+func TestEncodeBitmapRepeatRuns(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []int
+		spans [][2]int
+	}{
+		{"run then row", []int{2, 2, 3}, [][2]int{{0, 2}, {2, 1}}},
+		{"distinct rows", []int{2, 3, 4}, [][2]int{{0, 1}, {1, 1}, {2, 1}}},
+		{"row then run", []int{2, 3, 3, 3}, [][2]int{{0, 1}, {1, 3}}},
+		{"single run", []int{2, 2, 2}, [][2]int{{0, 3}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bitmap := NewBitmap(96, len(test.steps))
+			for y, step := range test.steps {
+				fillRow(bitmap, y, step)
+			}
+
+			rows := EncodeBitmap(bitmap)
+			if len(rows) != len(test.spans) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(test.spans))
+			}
+			for i, req := range rows {
+				data, ok := req.(packets.SetImageData)
+				if !ok {
+					t.Fatalf("row %d is %T, want SetImageData", i, req)
+				}
+				row, repeat := data.Span()
+				if row != test.spans[i][0] || repeat != test.spans[i][1] {
+					t.Errorf("row %d spans %d+%d, want %d+%d", i, row, repeat, test.spans[i][0], test.spans[i][1])
+				}
+				if !bytes.Equal(data.Bitmap, bitmap.Row(row)) {
+					t.Errorf("row %d bitmap %x, want %x", i, data.Bitmap, bitmap.Row(row))
+				}
+			}
+		})
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	bitmap := NewBitmap(96, 2)
+	fillRow(bitmap, 1, 3)
+
+	for y := 0; y < bitmap.Height; y++ {
+		want := fnv.New64a()
+		want.Write(bitmap.Row(y))
+		if got := bitmap.RowHash(y); got != want.Sum64() {
+			t.Errorf("row %d hashed to %x, want %x", y, got, want.Sum64())
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() { bitmap.RowHash(1) }); allocs != 0 {
+		t.Errorf("RowHash allocated %v times", allocs)
+	}
+}
@@ -0,0 +1,49 @@
+package image_encoder
+
+import "image/color"
+
+// Options controls how an image is turned into printable rows.
+type Options struct {
+	// Rotation turns the design to the feed direction before it is fitted
+	Rotation Rotation
+
+	// Fit, Align and Filter size the image to the label, see Fit. Upscale
+	// lets FitContain enlarge images smaller than the label, which blurs
+	// barcodes and other pixel-exact designs.
+	Fit     FitMode
+	Align   Align
+	Filter  Filter
+	Upscale bool
+
+	// Alpha and Background decide how transparent pixels print
+	Alpha      AlphaMode
+	Background color.Color
+
+	Dither Dither
+
+	// Threshold is the luminance, 0 to 255, below which a pixel becomes ink
+	// in ThresholdFixed mode. Error diffusion uses the same cut-off, ordered
+	// Bayer dithering ignores it.
+	Threshold     int
+	ThresholdMode ThresholdMode
+	// AdaptiveRadius is the size of the neighbourhood and AdaptiveOffset how
+	// much darker than its mean a pixel must be, in ThresholdAdaptive mode.
+	AdaptiveRadius int
+	AdaptiveOffset float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Rotation:       RotateAuto,
+		Fit:            FitContain,
+		Align:          AlignCenter,
+		Filter:         FilterLanczos,
+		Alpha:          AlphaBackground,
+		Background:     color.White,
+		Dither:         DitherThreshold,
+		Threshold:      128,
+		ThresholdMode:  ThresholdFixed,
+		AdaptiveRadius: 7,
+		AdaptiveOffset: 10,
+	}
+}
@@ -0,0 +1,74 @@
+package image_encoder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+var ErrUnknownRotation = errors.New("Unknown rotation")
+
+// Rotation turns the image clockwise, in degrees, before it is fitted to the
+// label. The printhead runs across the label width, so landscape designs
+// must be turned a quarter to be printed along the feed direction.
+type Rotation string
+
+const (
+	Rotate0   Rotation = "0"
+	Rotate90  Rotation = "90"
+	Rotate180 Rotation = "180"
+	Rotate270 Rotation = "270"
+	// RotateAuto turns landscape images 90 degrees and keeps portrait ones
+	RotateAuto Rotation = "auto"
+)
+
+var Rotations = []Rotation{Rotate0, Rotate90, Rotate180, Rotate270, RotateAuto}
+
+func ParseRotation(name string) (Rotation, error) {
+	for _, rotation := range Rotations {
+		if string(rotation) == name {
+			return rotation, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownRotation, name)
+}
+
+// Resolve returns the fixed rotation applied to img, picking one for
+// RotateAuto from its orientation.
+func (r Rotation) Resolve(img image.Image) Rotation {
+	if r != RotateAuto {
+		return r
+	}
+	if img.Bounds().Dx() > img.Bounds().Dy() {
+		return Rotate90
+	}
+	return Rotate0
+}
+
+// Inverse returns the rotation that undoes r. RotateAuto must be resolved
+// first.
+func (r Rotation) Inverse() Rotation {
+	switch r {
+	case Rotate90:
+		return Rotate270
+	case Rotate270:
+		return Rotate90
+	}
+	return r
+}
+
+// Rotate turns img clockwise as rotation says.
+func Rotate(img image.Image, rotation Rotation) image.Image {
+	// imaging rotates counter-clockwise
+	switch rotation.Resolve(img) {
+	case Rotate90:
+		return imaging.Rotate270(img)
+	case Rotate180:
+		return imaging.Rotate180(img)
+	case Rotate270:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
@@ -0,0 +1,155 @@
+package image_encoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownThresholdMode = errors.New("Unknown threshold mode")
+
+type ThresholdMode string
+
+const (
+	// ThresholdFixed uses Options.Threshold for every pixel
+	ThresholdFixed ThresholdMode = "fixed"
+	// ThresholdOtsu picks the level that best splits the image histogram in two
+	ThresholdOtsu ThresholdMode = "otsu"
+	// ThresholdAdaptive compares each pixel with the mean of its neighbourhood,
+	// for unevenly lit scans
+	ThresholdAdaptive ThresholdMode = "adaptive"
+)
+
+var ThresholdModes = []ThresholdMode{ThresholdFixed, ThresholdOtsu, ThresholdAdaptive}
+
+func ParseThresholdMode(name string) (ThresholdMode, error) {
+	for _, mode := range ThresholdModes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownThresholdMode, name)
+}
+
+// thresholds returns the level below which the pixel at each index of gray
+// becomes ink. Only the adaptive mode needs a level per pixel.
+func thresholds(gray []uint8, width, height int, options Options) func(i int) float64 {
+	switch options.ThresholdMode {
+	case ThresholdOtsu:
+		level := otsuThreshold(gray)
+		return func(int) float64 { return level }
+	case ThresholdAdaptive:
+		// A negative radius would make the window empty
+		means := newBoxMeans(gray, width, height, max(0, options.AdaptiveRadius))
+		offset := options.AdaptiveOffset
+		return func(i int) float64 { return means.at(i) - offset }
+	}
+	level := float64(options.Threshold)
+	return func(int) float64 { return level }
+}
+
+func otsuThreshold(gray []uint8) float64 {
+	var histogram [256]int
+	for _, value := range gray {
+		histogram[value]++
+	}
+
+	total := float64(len(gray))
+	sum := 0.0
+	for level, count := range histogram {
+		sum += float64(level * count)
+	}
+
+	best, bestVariance := 128, -1.0
+	backgroundWeight, backgroundSum := 0.0, 0.0
+	for level, count := range histogram {
+		backgroundWeight += float64(count)
+		backgroundSum += float64(level * count)
+		foregroundWeight := total - backgroundWeight
+		if backgroundWeight == 0 || foregroundWeight == 0 {
+			continue
+		}
+		backgroundMean := backgroundSum / backgroundWeight
+		foregroundMean := (sum - backgroundSum) / foregroundWeight
+		variance := backgroundWeight * foregroundWeight * (backgroundMean - foregroundMean) * (backgroundMean - foregroundMean)
+		if variance > bestVariance {
+			best, bestVariance = level, variance
+		}
+	}
+	// Pixels at the chosen level belong to the dark class
+	return float64(best) + 1
+}
+
+// boxMeans averages the (2*radius+1) square around every pixel, clipped at
+// the image edges. Pixels are asked for row by row, so it keeps the sum of
+// each column over the rows of the current window and slides it down
+// instead of storing a mean per pixel.
+type boxMeans struct {
+	gray                  []uint8
+	width, height, radius int
+
+	// columns holds the column sums over rows [top, bottom)
+	columns     []int
+	top, bottom int
+	row         int
+	// means and prefix are the current row and the running sum of columns
+	means  []float64
+	prefix []int
+}
+
+func newBoxMeans(gray []uint8, width, height, radius int) *boxMeans {
+	return &boxMeans{
+		gray:    gray,
+		width:   width,
+		height:  height,
+		radius:  radius,
+		columns: make([]int, width),
+		row:     -1,
+		means:   make([]float64, width),
+		prefix:  make([]int, width+1),
+	}
+}
+
+func (b *boxMeans) at(i int) float64 {
+	if y := i / b.width; y != b.row {
+		b.moveTo(y)
+	}
+	return b.means[i%b.width]
+}
+
+func (b *boxMeans) moveTo(y int) {
+	if y < b.row {
+		// Going back up, start the window over
+		clear(b.columns)
+		b.top, b.bottom = 0, 0
+	}
+	top, bottom := max(0, y-b.radius), min(b.height, y+b.radius+1)
+	for ; b.bottom < bottom; b.bottom++ {
+		b.addRow(b.bottom, 1)
+	}
+	for ; b.top < top; b.top++ {
+		b.addRow(b.top, -1)
+	}
+	b.row = y
+
+	for x, sum := range b.columns {
+		b.prefix[x+1] = b.prefix[x] + sum
+	}
+	rows := bottom - top
+	for x := range b.means {
+		left, right := max(0, x-b.radius), min(b.width, x+b.radius+1)
+		b.means[x] = float64(b.prefix[right]-b.prefix[left]) / float64(rows*(right-left))
+	}
+}
+
+func (b *boxMeans) addRow(y, sign int) {
+	for x, value := range b.gray[y*b.width : (y+1)*b.width] {
+		b.columns[x] += sign * int(value)
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,181 @@
+package image_encoder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOtsuThresholdBimodal(t *testing.T) {
+	// Dark values 30 to 50 and light values 190 to 210, the light class
+	// twice as large
+	var gray []uint8
+	for value := 30; value <= 50; value++ {
+		for i := 0; i < 10; i++ {
+			gray = append(gray, uint8(value))
+		}
+	}
+	for value := 190; value <= 210; value++ {
+		for i := 0; i < 20; i++ {
+			gray = append(gray, uint8(value))
+		}
+	}
+
+	// Every cut between the classes splits them the same, the first wins and
+	// pixels at the level are dark
+	if level := otsuThreshold(gray); level != 51 {
+		t.Errorf("got level %v, want 51", level)
+	}
+}
+
+func TestThresholdOtsuBinarize(t *testing.T) {
+	// Both classes are lighter than the fixed threshold
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 220
+		if i%3 == 0 {
+			img.Pix[i] = 140
+		}
+	}
+
+	options := DefaultOptions()
+	if bitmap := Binarize(img, options); countInk(bitmap) != 0 {
+		t.Fatalf("fixed threshold inked %d pixels, want none", countInk(bitmap))
+	}
+
+	options.ThresholdMode = ThresholdOtsu
+	bitmap := Binarize(img, options)
+	for i, value := range img.Pix {
+		x, y := i%8, i/8
+		if bitmap.Get(x, y) != (value == 140) {
+			t.Errorf("pixel %d,%d of value %d inked %v", x, y, value, bitmap.Get(x, y))
+		}
+	}
+}
+
+// gradientWithSpot is a horizontal gradient from 60 to 178 with a bright
+// 3x3 spot on its light side and a dark vertical stroke on its dark side.
+func gradientWithSpot() (*image.Gray, int) {
+	const stroke = 20
+	img := image.NewGray(image.Rect(0, 0, 60, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 60; x++ {
+			value := 60 + 2*x
+			if x == stroke {
+				value -= 50
+			}
+			if x >= 40 && x <= 42 && y >= 9 && y <= 11 {
+				value = 255
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(value)})
+		}
+	}
+	return img, stroke
+}
+
+func TestThresholdAdaptive(t *testing.T) {
+	img, stroke := gradientWithSpot()
+	options := DefaultOptions()
+
+	// The fixed threshold inks the whole dark side
+	if fixed := Binarize(img, options); !fixed.Get(5, 5) || !fixed.Get(25, 5) {
+		t.Fatal("fixed threshold left the dark side of the gradient white")
+	}
+
+	// Only the stroke is darker than its neighbourhood, the spot and the
+	// gradient around it stay white
+	options.ThresholdMode = ThresholdAdaptive
+	bitmap := Binarize(img, options)
+	for y := 0; y < bitmap.Height; y++ {
+		for x := 0; x < bitmap.Width; x++ {
+			if bitmap.Get(x, y) != (x == stroke) {
+				t.Errorf("pixel %d,%d inked %v", x, y, bitmap.Get(x, y))
+			}
+		}
+	}
+}
+
+func TestThresholdsNegativeRadius(t *testing.T) {
+	img, _ := gradientWithSpot()
+	options := DefaultOptions()
+	options.ThresholdMode = ThresholdAdaptive
+	options.AdaptiveRadius = -30
+
+	// A radius of 0 compares each pixel with itself, so nothing is darker
+	// than its mean by the offset
+	if bitmap := Binarize(img, options); countInk(bitmap) != 0 {
+		t.Errorf("got %d ink pixels, want none", countInk(bitmap))
+	}
+
+	options.AdaptiveOffset = -1
+	if bitmap := Binarize(img, options); countInk(bitmap) != bitmap.Width*bitmap.Height {
+		t.Errorf("got %d ink pixels with a negative offset, want all", countInk(bitmap))
+	}
+}
+
+func TestBoxMeans(t *testing.T) {
+	const width, height = 7, 5
+	gray := make([]uint8, width*height)
+	for i := range gray {
+		gray[i] = uint8(i * 37)
+	}
+
+	for radius := 0; radius <= 3; radius++ {
+		means := newBoxMeans(gray, width, height, radius)
+		// Rows in order, then back to the top
+		for _, y := range []int{0, 1, 2, 3, 4, 0, 3} {
+			for x := 0; x < width; x++ {
+				sum, count := 0, 0
+				for wy := max(0, y-radius); wy < min(height, y+radius+1); wy++ {
+					for wx := max(0, x-radius); wx < min(width, x+radius+1); wx++ {
+						sum += int(gray[wy*width+wx])
+						count++
+					}
+				}
+				want := float64(sum) / float64(count)
+				if got := means.at(y*width + x); got != want {
+					t.Errorf("radius %d: mean at %d,%d is %v, want %v", radius, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestGrayLevelsLuminance(t *testing.T) {
+	colors := []struct {
+		name  string
+		color color.NRGBA
+		want  uint8
+	}{
+		// 0.299, 0.587 and 0.114 of 255, rounded
+		{"red", color.NRGBA{R: 255, A: 255}, 76},
+		{"green", color.NRGBA{G: 255, A: 255}, 150},
+		{"blue", color.NRGBA{B: 255, A: 255}, 29},
+		{"white", color.NRGBA{R: 255, G: 255, B: 255, A: 255}, 255},
+		{"transparent", color.NRGBA{}, 255},
+	}
+
+	for _, test := range colors {
+		t.Run(test.name, func(t *testing.T) {
+			nrgba := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			nrgba.SetNRGBA(0, 0, test.color)
+			rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			rgba.Set(0, 0, test.color)
+
+			// NRGBA is read directly, RGBA through image.At
+			for _, img := range []image.Image{nrgba, rgba} {
+				if got := grayLevels(img, newCompositor(DefaultOptions()))[0]; got != test.want {
+					t.Errorf("%T: got %v, want %v", img, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func countInk(bitmap *Bitmap) int {
+	count := 0
+	for y := 0; y < bitmap.Height; y++ {
+		count += bitmap.InkCount(y, 0, bitmap.Stride*8)
+	}
+	return count
+}
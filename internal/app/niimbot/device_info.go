@@ -0,0 +1,145 @@
+package niimbot
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+type Version struct {
+	Major int
+	Minor int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%02d", v.Major, v.Minor)
+}
+
+type DeviceInfo struct {
+	Model            string
+	DeviceType       int
+	Serial           string
+	SoftVersion      Version
+	HardVersion      Version
+	Battery          int
+	Density          int
+	PrintSpeed       int
+	LabelType        int
+	LanguageType     int
+	AutoShutdownTime int
+}
+
+// GetDeviceInfo queries every GET_INFO key. Keys the firmware does not
+// support are left at their zero value.
+func (n *NiimbotPrinter) GetDeviceInfo(ctx context.Context) (*DeviceInfo, error) {
+	info := &DeviceInfo{}
+	var err error
+
+	if info.DeviceType, err = n.GetDeviceType(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	info.Model = ModelName(info.DeviceType)
+	if info.Serial, err = n.GetDeviceSerial(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.SoftVersion, err = n.GetSoftVersion(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.HardVersion, err = n.GetHardVersion(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.Battery, err = n.GetBattery(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.Density, err = n.GetDensity(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.PrintSpeed, err = n.GetPrintSpeed(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.LabelType, err = n.GetLabelType(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.LanguageType, err = n.GetLanguageType(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	if info.AutoShutdownTime, err = n.GetAutoShutdownTime(ctx); skipUnsupported(err) != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (n *NiimbotPrinter) GetDensity(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.DENSITY)
+}
+
+func (n *NiimbotPrinter) GetPrintSpeed(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.PRINTSPEED)
+}
+
+func (n *NiimbotPrinter) GetLabelType(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.LABELTYPE)
+}
+
+func (n *NiimbotPrinter) GetLanguageType(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.LANGUAGETYPE)
+}
+
+func (n *NiimbotPrinter) GetAutoShutdownTime(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.AUTOSHUTDOWNTIME)
+}
+
+func (n *NiimbotPrinter) GetDeviceType(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.DEVICETYPE)
+}
+
+// GetBattery returns the charge level, from 0 (empty) to 4 (full).
+func (n *NiimbotPrinter) GetBattery(ctx context.Context) (int, error) {
+	return n.getIntInfo(ctx, packets.NiimbotD11InfoPacket.BATTERY)
+}
+
+func (n *NiimbotPrinter) GetSoftVersion(ctx context.Context) (Version, error) {
+	return n.getVersionInfo(ctx, packets.NiimbotD11InfoPacket.SOFTVERSION)
+}
+
+func (n *NiimbotPrinter) GetHardVersion(ctx context.Context) (Version, error) {
+	return n.getVersionInfo(ctx, packets.NiimbotD11InfoPacket.HARDVERSION)
+}
+
+func (n *NiimbotPrinter) GetDeviceSerial(ctx context.Context) (string, error) {
+	data, err := n.getInfo(ctx, packets.NiimbotD11InfoPacket.DEVICESERIAL)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (n *NiimbotPrinter) getIntInfo(ctx context.Context, key int) (int, error) {
+	data, err := n.getInfo(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, ErrEmptyResponse
+	}
+	return decodeInt(data), nil
+}
+
+// getVersionInfo decodes versions sent as hundredths, 105 being 1.05.
+func (n *NiimbotPrinter) getVersionInfo(ctx context.Context, key int) (Version, error) {
+	value, err := n.getIntInfo(ctx, key)
+	if err != nil {
+		return Version{}, err
+	}
+	return Version{Major: value / 100, Minor: value % 100}, nil
+}
+
+func skipUnsupported(err error) error {
+	if errors.Is(err, ErrNotImplement) || errors.Is(err, ErrIllegalArgument) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+var (
+	ErrNoPrinterFound       = errors.New("No printer found")
+	ErrMultiplePrinterFound = errors.New("More than one printer found")
+)
+
+type DiscoveredPrinter struct {
+	Port       string
+	Model      string
+	DeviceType int
+	Serial     string
+	USBVID     string
+	USBPID     string
+}
+
+// Discover probes every serial port the OS reports and returns the ones with
+// a Niimbot printer answering GET_INFO.
+func Discover(ctx context.Context, mode serial.Mode) ([]DiscoveredPrinter, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	return discover(ctx, ports, mode), nil
+}
+
+// DiscoverPorts probes only the given ports, such as pseudo-terminals the OS
+// enumerator does not list.
+func DiscoverPorts(ctx context.Context, ports []string, mode serial.Mode) []DiscoveredPrinter {
+	details := make([]*enumerator.PortDetails, len(ports))
+	for i, port := range ports {
+		details[i] = &enumerator.PortDetails{Name: port}
+	}
+	return discover(ctx, details, mode)
+}
+
+// FindPrinter returns the port of the only printer found, and an error when
+// there is none or more than one.
+func FindPrinter(ctx context.Context, mode serial.Mode) (string, error) {
+	found, err := Discover(ctx, mode)
+	if err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", ErrNoPrinterFound
+	case 1:
+		return found[0].Port, nil
+	}
+	ports := make([]string, len(found))
+	for i, printer := range found {
+		ports[i] = printer.Port
+	}
+	return "", fmt.Errorf("%w: %v", ErrMultiplePrinterFound, ports)
+}
+
+func discover(ctx context.Context, ports []*enumerator.PortDetails, mode serial.Mode) []DiscoveredPrinter {
+	results := make([]*DiscoveredPrinter, len(ports))
+
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		wg.Add(1)
+		go func(i int, port *enumerator.PortDetails) {
+			defer wg.Done()
+			printer, err := identify(ctx, port.Name, mode)
+			if err != nil {
+				logger.LogDebug("No printer on", port.Name, err)
+				return
+			}
+			printer.USBVID = port.VID
+			printer.USBPID = port.PID
+			results[i] = printer
+		}(i, port)
+	}
+	wg.Wait()
+
+	found := make([]DiscoveredPrinter, 0)
+	for _, printer := range results {
+		if printer != nil {
+			found = append(found, *printer)
+		}
+	}
+	return found
+}
+
+func identify(ctx context.Context, comPort string, mode serial.Mode) (*DiscoveredPrinter, error) {
+	printer, err := openProbe(comPort, mode)
+	if err != nil {
+		return nil, err
+	}
+	defer printer.Close()
+
+	deviceType, err := printer.GetDeviceType(ctx)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := printer.GetDeviceSerial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiscoveredPrinter{
+		Port:       comPort,
+		Model:      ModelName(deviceType),
+		DeviceType: deviceType,
+		Serial:     serialNumber,
+	}, nil
+}
+
+// decodeInt reads a big endian unsigned integer of any length.
+func decodeInt(data []byte) int {
+	value := 0
+	for _, b := range data {
+		value = value<<8 | int(b)
+	}
+	return value
+}
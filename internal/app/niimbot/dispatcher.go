@@ -0,0 +1,269 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+const subscriberBuffer = 32
+
+type result struct {
+	pkt *packets.NiimbotPacket
+	err error
+}
+
+type waiter struct {
+	requestCode int
+	code        int
+	// sent orders the requests by when they went out, 0 until then and for
+	// requests that only wait
+	sent   int
+	result chan result
+}
+
+// dispatcher owns the read side of a Transport. A single goroutine parses
+// incoming packets and hands each one to the oldest request waiting for its
+// response code, error replies and corrupted frames to the request sent
+// last; packets nobody waits for go to the subscribers.
+type dispatcher struct {
+	transport Transport
+
+	sendMu      sync.Mutex
+	mu          sync.Mutex
+	waiters     []*waiter
+	subscribers map[int]chan packets.NiimbotPacket
+	nextID      int
+	sendSeq     int
+	err         error
+	done        chan struct{}
+}
+
+func newDispatcher(transport Transport) *dispatcher {
+	d := &dispatcher{
+		transport:   transport,
+		subscribers: make(map[int]chan packets.NiimbotPacket),
+		done:        make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *dispatcher) run() {
+	for {
+		pkt, err := d.transport.ReceivePacket()
+		if errors.Is(err, ErrInvalidChecksum) {
+			d.corrupted(err)
+			continue
+		}
+		if err != nil {
+			d.stop(err)
+			return
+		}
+		if pkt != nil {
+			logger.LogDebug("Received packet", pkt.ToBytes())
+			d.dispatch(pkt)
+		}
+	}
+}
+
+func (d *dispatcher) dispatch(pkt *packets.NiimbotPacket) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if isErrorResponse(int(pkt.Type)) {
+		if i := d.lastSent(); i >= 0 {
+			w := d.waiters[i]
+			d.waiters = append(d.waiters[:i], d.waiters[i+1:]...)
+			w.result <- result{err: &ProtocolError{
+				RequestCode:  w.requestCode,
+				ResponseCode: int(pkt.Type),
+				Payload:      pkt.Data,
+			}}
+			return
+		}
+	} else {
+		for i, w := range d.waiters {
+			if w.code != int(pkt.Type) {
+				continue
+			}
+			d.waiters = append(d.waiters[:i], d.waiters[i+1:]...)
+			w.result <- result{pkt: pkt}
+			return
+		}
+	}
+
+	logger.LogDebug("Received unsolicited packet", pkt.ToString())
+	for _, subscriber := range d.subscribers {
+		select {
+		case subscriber <- *pkt:
+		default:
+			logger.LogDebug("Subscriber is full, dropping packet", pkt.ToString())
+		}
+	}
+}
+
+// corrupted fails the request sent last with err, as dispatch does for error
+// replies. With no such request the frame is only logged.
+func (d *dispatcher) corrupted(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.lastSent()
+	if i < 0 {
+		logger.LogDebug("Dropped corrupted frame", err)
+		return
+	}
+	w := d.waiters[i]
+	d.waiters = append(d.waiters[:i], d.waiters[i+1:]...)
+	w.result <- result{err: err}
+}
+
+// lastSent returns the index of the waiter whose request went out last, -1
+// when none did. The printer does not say which request an error answers,
+// the latest one is the likeliest, and waiters that sent nothing such as
+// page notifications cannot have failed.
+func (d *dispatcher) lastSent() int {
+	last := -1
+	for i, w := range d.waiters {
+		if w.sent > 0 && (last < 0 || w.sent > d.waiters[last].sent) {
+			last = i
+		}
+	}
+	return last
+}
+
+func (d *dispatcher) stop(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	logger.LogDebug("Stopped reading from transport", err)
+	d.err = fmt.Errorf("%w: %w", ErrClosed, err)
+	for _, w := range d.waiters {
+		w.result <- result{err: d.err}
+	}
+	d.waiters = nil
+	for id, subscriber := range d.subscribers {
+		close(subscriber)
+		delete(d.subscribers, id)
+	}
+	close(d.done)
+}
+
+// request sends pkts as one uninterrupted block and waits for the reply with
+// responseCode. With no pkts it only waits.
+func (d *dispatcher) request(ctx context.Context, responseCode int, timeout time.Duration, pkts ...packets.NiimbotPacket) (*packets.NiimbotPacket, error) {
+	requestCode := -1
+	if len(pkts) > 0 {
+		requestCode = int(pkts[0].Type)
+	}
+	w, err := d.register(requestCode, responseCode)
+	if err != nil {
+		return nil, err
+	}
+	defer d.unregister(w)
+
+	if err := d.send(ctx, w, pkts); err != nil {
+		return nil, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case res := <-w.result:
+		return res.pkt, res.err
+	case <-waitCtx.Done():
+		return nil, contextError(waitCtx.Err())
+	}
+}
+
+func (d *dispatcher) send(ctx context.Context, w *waiter, pkts []packets.NiimbotPacket) error {
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	for i := range pkts {
+		if err := ctx.Err(); err != nil {
+			return contextError(err)
+		}
+		if i == 0 {
+			// Marked before sending, the reply can arrive before SendPacket returns
+			d.mu.Lock()
+			d.sendSeq++
+			w.sent = d.sendSeq
+			d.mu.Unlock()
+		}
+		logger.LogDebug("Sending packet", pkts[i].ToBytes())
+		if err := d.transport.SendPacket(&pkts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dispatcher) register(requestCode int, code int) (*waiter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	w := &waiter{
+		requestCode: requestCode,
+		code:        code,
+		result:      make(chan result, 1),
+	}
+	d.waiters = append(d.waiters, w)
+	return w, nil
+}
+
+func (d *dispatcher) unregister(w *waiter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, pending := range d.waiters {
+		if pending == w {
+			d.waiters = append(d.waiters[:i], d.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *dispatcher) subscribe() (<-chan packets.NiimbotPacket, func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subscriber := make(chan packets.NiimbotPacket, subscriberBuffer)
+	if d.err != nil {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+
+	id := d.nextID
+	d.nextID++
+	d.subscribers[id] = subscriber
+
+	return subscriber, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if _, ok := d.subscribers[id]; ok {
+			close(subscriber)
+			delete(d.subscribers, id)
+		}
+	}
+}
+
+func (d *dispatcher) close() error {
+	err := d.transport.Close()
+	<-d.done
+	return err
+}
+
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
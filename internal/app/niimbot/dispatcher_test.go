@@ -0,0 +1,436 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var errPipeClosed = errors.New("pipe closed")
+
+// pipeTransport is a Transport the test plays the printer on: packets the
+// dispatcher sends show up on sent and packets pushed to incoming are read
+// back as replies.
+type pipeTransport struct {
+	sent     chan packets.NiimbotPacket
+	incoming chan result
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newPipeTransport() *pipeTransport {
+	return &pipeTransport{
+		sent:     make(chan packets.NiimbotPacket, 16),
+		incoming: make(chan result),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (p *pipeTransport) SendPacket(pkt *packets.NiimbotPacket) error {
+	select {
+	case <-p.closed:
+		return errPipeClosed
+	case p.sent <- *pkt:
+		return nil
+	}
+}
+
+func (p *pipeTransport) ReceivePacket() (*packets.NiimbotPacket, error) {
+	select {
+	case res := <-p.incoming:
+		return res.pkt, res.err
+	case <-p.closed:
+		return nil, errPipeClosed
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (p *pipeTransport) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+// reply pushes a packet and returns once the dispatcher has read it.
+func (p *pipeTransport) reply(t *testing.T, code int, data ...byte) {
+	t.Helper()
+	p.push(t, result{pkt: &packets.NiimbotPacket{Type: byte(code), Data: data}})
+}
+
+// corrupt reports a frame with a bad checksum, the way the socket does.
+func (p *pipeTransport) corrupt(t *testing.T) {
+	t.Helper()
+	p.push(t, result{err: fmt.Errorf("%w: frame", packets.ErrInvalidChecksum)})
+}
+
+func (p *pipeTransport) push(t *testing.T, res result) {
+	t.Helper()
+	select {
+	case p.incoming <- res:
+	case <-time.After(time.Second):
+		t.Fatal("dispatcher did not read the reply")
+	}
+}
+
+// waitForWaiters blocks until n requests are registered, so tests control
+// the order they queue in.
+func waitForWaiters(t *testing.T, d *dispatcher, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		d.mu.Lock()
+		registered := len(d.waiters)
+		d.mu.Unlock()
+		if registered == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d waiters", n)
+}
+
+type testRequest struct {
+	// requestCode is the packet sent, -1 for a request that only waits
+	requestCode  int
+	responseCode int
+}
+
+// startRequests issues reqs one after the other, each registered and sent
+// before the next, and returns the channel each one's result arrives on.
+func startRequests(t *testing.T, d *dispatcher, p *pipeTransport, reqs []testRequest) []chan result {
+	t.Helper()
+	results := make([]chan result, len(reqs))
+	for i, req := range reqs {
+		var pkts []packets.NiimbotPacket
+		if req.requestCode >= 0 {
+			pkts = append(pkts, packets.NiimbotPacket{Type: byte(req.requestCode), Data: []byte{1}})
+		}
+		results[i] = make(chan result, 1)
+		go func(i int, responseCode int) {
+			pkt, err := d.request(context.Background(), responseCode, time.Second, pkts...)
+			results[i] <- result{pkt: pkt, err: err}
+		}(i, req.responseCode)
+
+		waitForWaiters(t, d, i+1)
+		if len(pkts) > 0 {
+			select {
+			case <-p.sent:
+			case <-time.After(time.Second):
+				t.Fatalf("request %d was not sent", i)
+			}
+		}
+	}
+	return results
+}
+
+func TestDispatcherRoutesReplies(t *testing.T) {
+	illegal := packets.NiimbotD11ResponseCodePacket.ILLEGAL_ARGUMENT
+
+	type want struct {
+		// data is the first payload byte of the reply
+		data byte
+		// failedCode is the request code the ProtocolError names, 0 when the
+		// request gets a reply
+		failedCode int
+	}
+	tests := []struct {
+		name    string
+		reqs    []testRequest
+		replies []packets.NiimbotPacket
+		want    []want
+	}{
+		{
+			name:    "single reply",
+			reqs:    []testRequest{{1, 11}},
+			replies: []packets.NiimbotPacket{{Type: 11, Data: []byte{7}}},
+			want:    []want{{data: 7}},
+		},
+		{
+			name:    "out of order",
+			reqs:    []testRequest{{1, 11}, {2, 12}, {3, 13}},
+			replies: []packets.NiimbotPacket{{Type: 13, Data: []byte{3}}, {Type: 11, Data: []byte{1}}, {Type: 12, Data: []byte{2}}},
+			want:    []want{{data: 1}, {data: 2}, {data: 3}},
+		},
+		{
+			name:    "same code goes to the oldest",
+			reqs:    []testRequest{{1, 11}, {1, 11}},
+			replies: []packets.NiimbotPacket{{Type: 11, Data: []byte{1}}, {Type: 11, Data: []byte{2}}},
+			want:    []want{{data: 1}, {data: 2}},
+		},
+		{
+			name:    "error goes to the request sent last",
+			reqs:    []testRequest{{1, 11}, {2, 12}},
+			replies: []packets.NiimbotPacket{{Type: byte(illegal)}, {Type: 11, Data: []byte{1}}},
+			want:    []want{{data: 1}, {failedCode: 2}},
+		},
+		{
+			name:    "error skips wait-only requests",
+			reqs:    []testRequest{{1, 11}, {-1, 224}},
+			replies: []packets.NiimbotPacket{{Type: byte(illegal)}, {Type: 224, Data: []byte{9}}},
+			want:    []want{{failedCode: 1}, {data: 9}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipe := newPipeTransport()
+			d := newDispatcher(pipe)
+			defer d.close()
+
+			results := startRequests(t, d, pipe, test.reqs)
+			for _, reply := range test.replies {
+				pipe.reply(t, int(reply.Type), reply.Data...)
+			}
+
+			for i, want := range test.want {
+				var res result
+				select {
+				case res = <-results[i]:
+				case <-time.After(2 * time.Second):
+					t.Fatalf("request %d got no result", i)
+				}
+
+				if want.failedCode != 0 {
+					var protocolErr *ProtocolError
+					if !errors.As(res.err, &protocolErr) || !errors.Is(res.err, ErrIllegalArgument) {
+						t.Fatalf("request %d: got %v, want an IllegalArgument ProtocolError", i, res.err)
+					}
+					if protocolErr.RequestCode != want.failedCode {
+						t.Errorf("request %d: error attributed to %d, want %d", i, protocolErr.RequestCode, want.failedCode)
+					}
+					continue
+				}
+				if res.err != nil {
+					t.Fatalf("request %d: %v", i, res.err)
+				}
+				if len(res.pkt.Data) == 0 || res.pkt.Data[0] != want.data {
+					t.Errorf("request %d: got reply %v, want data %d", i, res.pkt.Data, want.data)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherCorruptedFrame(t *testing.T) {
+	pipe := newPipeTransport()
+	d := newDispatcher(pipe)
+	defer d.close()
+
+	results := startRequests(t, d, pipe, []testRequest{{1, 11}, {-1, 224}, {2, 12}})
+	pipe.corrupt(t)
+	pipe.corrupt(t)
+	pipe.reply(t, 224, 9)
+
+	for i, wantErr := range []bool{true, false, true} {
+		select {
+		case res := <-results[i]:
+			if errors.Is(res.err, ErrInvalidChecksum) != wantErr {
+				t.Errorf("request %d: got %v, want checksum error %v", i, res.err, wantErr)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %d got no result", i)
+		}
+	}
+
+	// The connection is still up
+	results = startRequests(t, d, pipe, []testRequest{{3, 13}})
+	pipe.reply(t, 13, 3)
+	if res := <-results[0]; res.err != nil {
+		t.Errorf("request after a corrupted frame: %v", res.err)
+	}
+}
+
+func TestDispatcherSubscribers(t *testing.T) {
+	illegal := packets.NiimbotD11ResponseCodePacket.ILLEGAL_ARGUMENT
+
+	tests := []struct {
+		name  string
+		reqs  []testRequest
+		reply packets.NiimbotPacket
+	}{
+		{"nobody waits", nil, packets.NiimbotPacket{Type: 224, Data: []byte{1}}},
+		{"nobody waits for the code", []testRequest{{1, 11}}, packets.NiimbotPacket{Type: 224, Data: []byte{1}}},
+		{"error with only wait-only requests", []testRequest{{-1, 224}}, packets.NiimbotPacket{Type: byte(illegal)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipe := newPipeTransport()
+			d := newDispatcher(pipe)
+			defer d.close()
+
+			first, unsubscribe := d.subscribe()
+			defer unsubscribe()
+			second, unsubscribeSecond := d.subscribe()
+			defer unsubscribeSecond()
+
+			results := startRequests(t, d, pipe, test.reqs)
+			pipe.reply(t, int(test.reply.Type), test.reply.Data...)
+
+			for _, subscriber := range []<-chan packets.NiimbotPacket{first, second} {
+				select {
+				case pkt := <-subscriber:
+					if pkt.Type != test.reply.Type {
+						t.Errorf("subscriber got packet %d, want %d", pkt.Type, test.reply.Type)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("subscriber got no packet")
+				}
+			}
+			for i, res := range results {
+				select {
+				case r := <-res:
+					t.Errorf("request %d was answered by an unsolicited packet: %v %v", i, r.pkt, r.err)
+				default:
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherUnsubscribe(t *testing.T) {
+	pipe := newPipeTransport()
+	d := newDispatcher(pipe)
+	defer d.close()
+
+	subscriber, unsubscribe := d.subscribe()
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-subscriber; ok {
+		t.Error("subscriber is still open after unsubscribing")
+	}
+	pipe.reply(t, 224)
+}
+
+func mustSubscribe(d *dispatcher) <-chan packets.NiimbotPacket {
+	subscriber, _ := d.subscribe()
+	return subscriber
+}
+
+func TestDispatcherCloseReleasesWaiters(t *testing.T) {
+	pipe := newPipeTransport()
+	d := newDispatcher(pipe)
+	subscriber, unsubscribe := d.subscribe()
+	defer unsubscribe()
+
+	results := startRequests(t, d, pipe, []testRequest{{1, 11}, {-1, 224}, {2, 12}})
+	if err := d.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, res := range results {
+		select {
+		case r := <-res:
+			if !errors.Is(r.err, ErrClosed) || !errors.Is(r.err, errPipeClosed) {
+				t.Errorf("request %d: got %v, want ErrClosed wrapping the transport error", i, r.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %d is still waiting after close", i)
+		}
+	}
+	if _, ok := <-subscriber; ok {
+		t.Error("subscriber is still open after close")
+	}
+	if _, err := d.request(context.Background(), 11, time.Second); !errors.Is(err, ErrClosed) {
+		t.Errorf("request after close: got %v, want ErrClosed", err)
+	}
+	if _, ok := <-mustSubscribe(d); ok {
+		t.Error("subscribing after close returned an open channel")
+	}
+}
+
+func TestDispatcherDeadlines(t *testing.T) {
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		timeout time.Duration
+		send    bool
+		// timedOut is whether the error is ErrTimeout, wrapping cause
+		timedOut bool
+		cause    error
+	}{
+		{
+			name: "ctx deadline while waiting",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 30*time.Millisecond)
+			},
+			timeout:  time.Minute,
+			send:     true,
+			timedOut: true,
+			cause:    context.DeadlineExceeded,
+		},
+		{
+			name:     "response timeout",
+			ctx:      func() (context.Context, context.CancelFunc) { return context.Background(), func() {} },
+			timeout:  30 * time.Millisecond,
+			send:     true,
+			timedOut: true,
+			cause:    context.DeadlineExceeded,
+		},
+		{
+			name:     "ctx deadline before sending",
+			ctx:      func() (context.Context, context.CancelFunc) { return expired, func() {} },
+			timeout:  time.Minute,
+			send:     true,
+			timedOut: true,
+			cause:    context.DeadlineExceeded,
+		},
+		{
+			name:    "ctx canceled before sending",
+			ctx:     func() (context.Context, context.CancelFunc) { return canceled, func() {} },
+			timeout: time.Minute,
+			send:    true,
+			cause:   context.Canceled,
+		},
+		{
+			name: "ctx deadline while only waiting",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 30*time.Millisecond)
+			},
+			timeout:  time.Minute,
+			timedOut: true,
+			cause:    context.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipe := newPipeTransport()
+			d := newDispatcher(pipe)
+			defer d.close()
+
+			var pkts []packets.NiimbotPacket
+			if test.send {
+				pkts = append(pkts, packets.NiimbotPacket{Type: 1})
+			}
+			ctx, cancel := test.ctx()
+			defer cancel()
+
+			_, err := d.request(ctx, 11, test.timeout, pkts...)
+			if !errors.Is(err, test.cause) || errors.Is(err, ErrTimeout) != test.timedOut {
+				t.Errorf("got %v, want %v with timed out %v", err, test.cause, test.timedOut)
+			}
+			waitForWaiters(t, d, 0)
+
+			// A late reply must not reach the request that gave up
+			subscriber, unsubscribe := d.subscribe()
+			defer unsubscribe()
+			pipe.reply(t, 11)
+			select {
+			case <-subscriber:
+			case <-time.After(time.Second):
+				t.Error("late reply did not go to the subscribers")
+			}
+		})
+	}
+}
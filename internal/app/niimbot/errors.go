@@ -0,0 +1,25 @@
+package niimbot
+
+import (
+	"errors"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var (
+	ErrTimeout          = errors.New("Timed out waiting for printer response")
+	ErrClosed           = errors.New("Printer connection is closed")
+	ErrIllegalArgument  = errors.New("Printer reported IllegalArgument")
+	ErrNotImplement     = errors.New("Printer reported NotImplement")
+	ErrEmptyResponse    = errors.New("Printer sent an empty response")
+	ErrInvalidResponse  = errors.New("Printer sent an invalid response")
+	ErrInvalidLabelType = errors.New("Invalid label type")
+	ErrInvalidDensity   = errors.New("Invalid label density")
+	ErrInvalidQuantity  = errors.New("Invalid quantity")
+	ErrInvalidImage     = errors.New("Invalid image")
+	ErrInvalidDimension = errors.New("Invalid label dimension")
+	ErrInvalidSetting   = errors.New("Invalid setting value")
+	// ErrInvalidChecksum fails the request sent last when a frame arrives
+	// corrupted, it is most likely the reply
+	ErrInvalidChecksum = packets.ErrInvalidChecksum
+)
@@ -0,0 +1,116 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var (
+	ErrLidOpen = errors.New("Printer lid is open")
+	ErrNoPaper = errors.New("Printer is out of labels")
+)
+
+// PrinterStatus is the decoded HEARTBEAT response. Models report different
+// subsets, so each field has a Has flag saying whether it was present.
+type PrinterStatus struct {
+	LidClosed       bool
+	HasLidState     bool
+	PaperPresent    bool
+	HasPaperState   bool
+	BatteryLevel    int
+	HasBatteryLevel bool
+	RFIDRead        bool
+	HasRFIDState    bool
+}
+
+func (s PrinterStatus) String() string {
+	parts := make([]string, 0)
+	if s.HasLidState {
+		parts = append(parts, stateName(s.LidClosed, "lid closed", "lid open"))
+	}
+	if s.HasPaperState {
+		parts = append(parts, stateName(s.PaperPresent, "paper present", "out of labels"))
+	}
+	if s.HasBatteryLevel {
+		parts = append(parts, fmt.Sprintf("battery %d/4", s.BatteryLevel))
+	}
+	if s.HasRFIDState {
+		parts = append(parts, stateName(s.RFIDRead, "RFID read", "RFID not read"))
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func stateName(state bool, whenTrue string, whenFalse string) string {
+	if state {
+		return whenTrue
+	}
+	return whenFalse
+}
+
+// Ready returns ErrLidOpen or ErrNoPaper when the status says printing would
+// fail. States the model does not report are assumed fine.
+func (s PrinterStatus) Ready() error {
+	if s.HasLidState && !s.LidClosed {
+		return ErrLidOpen
+	}
+	if s.HasPaperState && !s.PaperPresent {
+		return ErrNoPaper
+	}
+	return nil
+}
+
+func (n *NiimbotPrinter) Heartbeat(ctx context.Context) (*PrinterStatus, error) {
+	logger.LogDebug("Sending heartbeat")
+	pkt, err := n.transcieve(ctx, packets.Heartbeat{})
+	if err != nil {
+		return nil, err
+	}
+	return parseHeartbeat(pkt.Data)
+}
+
+func parseHeartbeat(data []byte) (*PrinterStatus, error) {
+	status := &PrinterStatus{}
+	// Offsets of each state per payload length, -1 when not reported
+	lid, battery, paper, rfid := -1, -1, -1, -1
+
+	switch len(data) {
+	case 20:
+		paper, rfid = 18, 19
+	case 19:
+		lid, battery, paper, rfid = 15, 16, 17, 18
+	case 13:
+		lid, battery, paper, rfid = 9, 10, 11, 12
+	case 10:
+		lid, battery = 8, 9
+	case 9:
+		lid = 8
+	default:
+		return nil, fmt.Errorf("%w: unexpected heartbeat length %d", ErrInvalidResponse, len(data))
+	}
+
+	if lid >= 0 {
+		status.HasLidState = true
+		status.LidClosed = data[lid] == 0
+	}
+	if battery >= 0 {
+		status.HasBatteryLevel = true
+		status.BatteryLevel = int(data[battery])
+	}
+	if paper >= 0 {
+		status.HasPaperState = true
+		status.PaperPresent = data[paper] == 0
+	}
+	if rfid >= 0 {
+		status.HasRFIDState = true
+		status.RFIDRead = data[rfid] != 0
+	}
+	return status, nil
+}
@@ -0,0 +1,95 @@
+package niimbot
+
+import (
+	"errors"
+	"testing"
+)
+
+// heartbeat builds a payload of length bytes with the given values set at
+// their offsets.
+func heartbeat(length int, values map[int]byte) []byte {
+	data := make([]byte, length)
+	for offset, value := range values {
+		data[offset] = value
+	}
+	return data
+}
+
+func TestParseHeartbeat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want PrinterStatus
+	}{
+		{
+			name: "20 bytes, paper out and RFID read",
+			data: heartbeat(20, map[int]byte{18: 1, 19: 1}),
+			want: PrinterStatus{HasPaperState: true, RFIDRead: true, HasRFIDState: true},
+		},
+		{
+			name: "20 bytes, paper present and no RFID",
+			data: heartbeat(20, nil),
+			want: PrinterStatus{PaperPresent: true, HasPaperState: true, HasRFIDState: true},
+		},
+		{
+			name: "19 bytes, lid open",
+			data: heartbeat(19, map[int]byte{15: 1, 16: 3, 18: 1}),
+			want: PrinterStatus{
+				HasLidState:  true,
+				PaperPresent: true, HasPaperState: true,
+				BatteryLevel: 3, HasBatteryLevel: true,
+				RFIDRead: true, HasRFIDState: true,
+			},
+		},
+		{
+			name: "13 bytes, paper out",
+			data: heartbeat(13, map[int]byte{10: 4, 11: 1}),
+			want: PrinterStatus{
+				LidClosed: true, HasLidState: true,
+				HasPaperState: true,
+				BatteryLevel:  4, HasBatteryLevel: true,
+				HasRFIDState: true,
+			},
+		},
+		{
+			name: "13 bytes, RFID read",
+			data: heartbeat(13, map[int]byte{9: 1, 10: 2, 12: 1}),
+			want: PrinterStatus{
+				HasLidState:  true,
+				PaperPresent: true, HasPaperState: true,
+				BatteryLevel: 2, HasBatteryLevel: true,
+				RFIDRead: true, HasRFIDState: true,
+			},
+		},
+		{
+			name: "10 bytes",
+			data: heartbeat(10, map[int]byte{8: 1, 9: 1}),
+			want: PrinterStatus{HasLidState: true, BatteryLevel: 1, HasBatteryLevel: true},
+		},
+		{
+			name: "9 bytes",
+			data: heartbeat(9, nil),
+			want: PrinterStatus{LidClosed: true, HasLidState: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := parseHeartbeat(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *status != test.want {
+				t.Errorf("got %+v, want %+v", *status, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHeartbeatUnknownLength(t *testing.T) {
+	for _, length := range []int{0, 8, 11, 14, 21} {
+		if status, err := parseHeartbeat(make([]byte, length)); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%d bytes: got %+v %v, want ErrInvalidResponse", length, status, err)
+		}
+	}
+}
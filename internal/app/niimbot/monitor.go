@@ -0,0 +1,169 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+)
+
+type MonitorEventType int
+
+const (
+	EventBatteryChanged MonitorEventType = iota
+	EventLidOpened
+	EventLidClosed
+	EventPaperOut
+	EventPaperLoaded
+	EventConnectionLost
+)
+
+func (t MonitorEventType) String() string {
+	switch t {
+	case EventBatteryChanged:
+		return "battery changed"
+	case EventLidOpened:
+		return "lid opened"
+	case EventLidClosed:
+		return "lid closed"
+	case EventPaperOut:
+		return "out of labels"
+	case EventPaperLoaded:
+		return "labels loaded"
+	case EventConnectionLost:
+		return "connection lost"
+	}
+	return "unknown"
+}
+
+// MonitorEvent is a status change seen by the monitor. Status is nil for
+// EventConnectionLost, which carries the error that ended the monitor.
+type MonitorEvent struct {
+	Type     MonitorEventType
+	Time     time.Time
+	Status   *PrinterStatus
+	Previous *PrinterStatus
+	Err      error
+}
+
+// MaxMissedHeartbeats is how many heartbeats in a row may go unanswered
+// before the monitor reports the connection as lost.
+var MaxMissedHeartbeats = 3
+
+// Monitor sends HEARTBEAT on an interval, which also keeps the printer from
+// shutting down while idle, and publishes status changes on Events.
+type Monitor struct {
+	Events <-chan MonitorEvent
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartMonitor runs a monitor until ctx is done, Stop is called or the
+// connection is lost. Events is closed when it ends.
+func (n *NiimbotPrinter) StartMonitor(ctx context.Context, interval time.Duration) *Monitor {
+	ctx, cancel := context.WithCancel(ctx)
+	events := make(chan MonitorEvent, 16)
+	m := &Monitor{
+		Events: events,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go m.run(ctx, n, interval, events)
+	return m
+}
+
+func (m *Monitor) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+func (m *Monitor) run(ctx context.Context, n *NiimbotPrinter, interval time.Duration, events chan<- MonitorEvent) {
+	defer close(m.done)
+	defer close(events)
+
+	publish := func(event MonitorEvent) bool {
+		event.Time = time.Now()
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *PrinterStatus
+	missed := 0
+	for {
+		status, err := n.Heartbeat(ctx)
+		switch {
+		case err == nil:
+			missed = 0
+			for _, eventType := range statusChanges(previous, status) {
+				if !publish(MonitorEvent{Type: eventType, Status: status, Previous: previous}) {
+					return
+				}
+			}
+			previous = status
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, ErrClosed):
+			publish(MonitorEvent{Type: EventConnectionLost, Previous: previous, Err: err})
+			return
+		case errors.Is(err, ErrTimeout):
+			missed++
+			logger.LogDebug("Heartbeat missed", missed, err)
+			if missed >= MaxMissedHeartbeats {
+				publish(MonitorEvent{Type: EventConnectionLost, Previous: previous, Err: err})
+				return
+			}
+		default:
+			logger.LogDebug("Heartbeat failed", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// statusChanges lists the events between two heartbeats. The first heartbeat
+// only reports problems, not the initial state.
+func statusChanges(previous *PrinterStatus, current *PrinterStatus) []MonitorEventType {
+	changes := make([]MonitorEventType, 0)
+	if previous == nil {
+		previous = &PrinterStatus{
+			LidClosed:       true,
+			HasLidState:     current.HasLidState,
+			PaperPresent:    true,
+			HasPaperState:   current.HasPaperState,
+			BatteryLevel:    current.BatteryLevel,
+			HasBatteryLevel: current.HasBatteryLevel,
+		}
+	}
+
+	if current.HasLidState && previous.HasLidState && current.LidClosed != previous.LidClosed {
+		if current.LidClosed {
+			changes = append(changes, EventLidClosed)
+		} else {
+			changes = append(changes, EventLidOpened)
+		}
+	}
+	if current.HasPaperState && previous.HasPaperState && current.PaperPresent != previous.PaperPresent {
+		if current.PaperPresent {
+			changes = append(changes, EventPaperLoaded)
+		} else {
+			changes = append(changes, EventPaperOut)
+		}
+	}
+	if current.HasBatteryLevel && previous.HasBatteryLevel && current.BatteryLevel != previous.BatteryLevel {
+		changes = append(changes, EventBatteryChanged)
+	}
+	return changes
+}
@@ -1,6 +1,8 @@
 package niimbot
 
 import (
+	"context"
+	"fmt"
 	"image"
 	"time"
 
@@ -9,154 +11,372 @@ import (
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
 	serialsocket "github.com/matheustavarestrindade/niimprintgo/internal/app/socket"
+	"go.bug.st/serial"
 )
 
 type NiimbotPrinter struct {
-	SerialSocket *serialsocket.SerialSocket
+	Transport Transport
+
+	// ResponseTimeout bounds the wait for the reply to a single command and
+	// PageTimeout the wait for each printed page, on top of any ctx deadline.
+	ResponseTimeout time.Duration
+	PageTimeout     time.Duration
+
+	// Profile is the model being driven. PrintLabel detects it when nil.
+	Profile *Profile
+
+	dispatcher *dispatcher
+}
+
+func NewNiimbotPrinter(comPort string) (*NiimbotPrinter, error) {
+	return NewNiimbotPrinterWithMode(comPort, serialsocket.DefaultMode())
 }
 
-func NewNiimbotPrinter(comPort string) *NiimbotPrinter {
-	printer := &NiimbotPrinter{
-		SerialSocket: serialsocket.NewSerialSocket(comPort),
+func NewNiimbotPrinterWithMode(comPort string, mode serial.Mode) (*NiimbotPrinter, error) {
+	socket := serialsocket.NewSerialSocketWithMode(comPort, mode)
+	if err := socket.Connect(); err != nil {
+		return nil, err
 	}
-	printer.SerialSocket.Connect()
-	logger.LogInfo("Connected to", comPort)
-	return printer
+	logger.LogInfo("Connected to", comPort, "at", mode.BaudRate, "baud")
+	return NewNiimbotPrinterWithTransport(socket), nil
 }
 
-func (n *NiimbotPrinter) sendCodeAndConfirm(code int, data []byte, offset int) bool {
-	pkt := n.SerialSocket.Transcieve(code, data, offset)
-	if pkt == nil {
-		logger.LogError("Error sending code and confirming", code, data, offset)
-		panic("Error sending code and confirming")
+func NewNiimbotPrinterWithTransport(transport Transport) *NiimbotPrinter {
+	return &NiimbotPrinter{
+		Transport: transport,
+
+		ResponseTimeout: 2 * time.Second,
+		PageTimeout:     30 * time.Second,
+
+		dispatcher: newDispatcher(transport),
+	}
+}
+
+func (n *NiimbotPrinter) Close() error {
+	return n.dispatcher.close()
+}
+
+func (n *NiimbotPrinter) sendCodeAndConfirm(ctx context.Context, req packets.Request) (bool, error) {
+	pkt, err := n.transcieve(ctx, req)
+	if err != nil {
+		logger.LogDebug("Error sending code and confirming", req.Code(), req, err)
+		return false, err
+	}
+	confirmation, err := packets.ParseConfirmation(pkt)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	return confirmation.OK, nil
+}
+
+func (n *NiimbotPrinter) getInfo(ctx context.Context, key int) ([]byte, error) {
+	logger.LogDebug("Getting info", key)
+	pkt, err := n.transcieve(ctx, packets.GetInfo{Key: key})
+	if err != nil {
+		return nil, err
 	}
-	return int(pkt.Data[0]) != 0
+	return pkt.Data, nil
 }
 
-func (n *NiimbotPrinter) SetLabelType(labelType int) bool {
-	if labelType > 3 || labelType < 1 {
-		logger.LogError("Invalid label type", labelType)
-		panic("Invalid label type")
+func (n *NiimbotPrinter) SetLabelType(ctx context.Context, labelType int) (bool, error) {
+	if err := n.profile().ValidLabelType(labelType); err != nil {
+		return false, err
 	}
 	logger.LogDebug("Setting label type", labelType)
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.SET_LABEL_TYPE, []byte{byte(labelType)}, 16)
+	return n.sendCodeAndConfirm(ctx, packets.SetLabelType{Type: labelType})
 }
 
-func (n *NiimbotPrinter) SetLabelDensity(density int) bool {
-	if density > 3 || density < 1 {
-		logger.LogError("Invalid label density", density)
-		panic("Invalid label density")
+func (n *NiimbotPrinter) SetLabelDensity(ctx context.Context, density int) (bool, error) {
+	if err := n.profile().ValidDensity(density); err != nil {
+		return false, err
 	}
 	logger.LogDebug("Setting label density", density)
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.SET_LABEL_DENSITY, []byte{byte(density)}, 16)
+	return n.sendCodeAndConfirm(ctx, packets.SetLabelDensity{Density: density})
 }
 
-func (n *NiimbotPrinter) StartPrint() bool {
+func (n *NiimbotPrinter) StartPrint(ctx context.Context) (bool, error) {
 	logger.LogDebug("Starting print")
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.START_PRINT, []byte{0x01}, 1)
+	return n.sendCodeAndConfirm(ctx, packets.StartPrint{})
 }
 
-func (n *NiimbotPrinter) EndPrint() bool {
+// StartPrintWithPages starts a job of totalPages pages on models with the
+// PrintStartWithPages quirk.
+func (n *NiimbotPrinter) StartPrintWithPages(ctx context.Context, totalPages int) (bool, error) {
+	if totalPages < 1 || totalPages > 65535 {
+		return false, fmt.Errorf("%w: %d", ErrInvalidQuantity, totalPages)
+	}
+	logger.LogDebug("Starting print of", totalPages, "pages")
+	return n.sendCodeAndConfirm(ctx, packets.StartPrint{TotalPages: totalPages})
+}
+
+func (n *NiimbotPrinter) EndPrint(ctx context.Context) (bool, error) {
 	logger.LogDebug("Ending print")
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.END_PRINT, []byte{0x01}, 1)
+	return n.sendCodeAndConfirm(ctx, packets.EndPrint{})
 }
 
-func (n *NiimbotPrinter) StartPagePrint() bool {
+func (n *NiimbotPrinter) StartPagePrint(ctx context.Context) (bool, error) {
 	logger.LogDebug("Starting page print")
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.START_PAGE_PRINT, []byte{0x01}, 1)
+	return n.sendCodeAndConfirm(ctx, packets.StartPagePrint{})
 }
 
-func (n *NiimbotPrinter) EndPagePrint() bool {
+func (n *NiimbotPrinter) EndPagePrint(ctx context.Context) (bool, error) {
 	logger.LogDebug("Ending page print")
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.END_PAGE_PRINT, []byte{0x01}, 1)
+	return n.sendCodeAndConfirm(ctx, packets.EndPagePrint{})
 }
 
-func (n *NiimbotPrinter) AllowPrintClear() bool {
+func (n *NiimbotPrinter) AllowPrintClear(ctx context.Context) (bool, error) {
 	logger.LogDebug("Allowing print clear")
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.ALLOW_PRINT_CLEAR, []byte{0x01}, 16)
+	return n.sendCodeAndConfirm(ctx, packets.AllowPrintClear{})
 }
 
-func (n *NiimbotPrinter) SetDimension(w int, h int) bool {
-	width := helpers.ShortToByteArray(w)
-	height := helpers.ShortToByteArray(h)
-
-	payload := make([]byte, 0)
-	payload = append(payload, height...)
-	payload = append(payload, width...)
-
+func (n *NiimbotPrinter) SetDimension(ctx context.Context, w int, h int) (bool, error) {
+	if !helpers.ValidShort(w) || !helpers.ValidShort(h) {
+		return false, fmt.Errorf("%w: %dx%d", ErrInvalidDimension, w, h)
+	}
 	logger.LogDebug("Setting dimension", w, h)
+	return n.sendCodeAndConfirm(ctx, packets.SetDimension{Width: w, Height: h})
+}
 
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.SET_DIMENSION, payload, 1)
+// SetDimensionWithCopies replaces SetDimension and SetQuantity on models with
+// the DimensionWithQuantity quirk.
+func (n *NiimbotPrinter) SetDimensionWithCopies(ctx context.Context, w int, h int, copies int) (bool, error) {
+	if !helpers.ValidShort(w) || !helpers.ValidShort(h) {
+		return false, fmt.Errorf("%w: %dx%d", ErrInvalidDimension, w, h)
+	}
+	if copies < 1 || copies > 65535 {
+		return false, fmt.Errorf("%w: %d", ErrInvalidQuantity, copies)
+	}
+	logger.LogDebug("Setting dimension", w, h, "copies", copies)
+	return n.sendCodeAndConfirm(ctx, packets.SetDimension{Width: w, Height: h, Copies: copies})
 }
 
-func (n *NiimbotPrinter) SetQuantity(quantity int) bool {
+func (n *NiimbotPrinter) SetQuantity(ctx context.Context, quantity int) (bool, error) {
+	if quantity < 1 || quantity > 65535 {
+		return false, fmt.Errorf("%w: %d", ErrInvalidQuantity, quantity)
+	}
 	logger.LogDebug("Setting quantity", quantity)
-	return n.sendCodeAndConfirm(packets.NiimbotD11RequestCodePacket.SET_QUANTITY, helpers.ShortToByteArray(quantity), 1)
+	return n.sendCodeAndConfirm(ctx, packets.SetQuantity{N: quantity})
 }
 
-func (n *NiimbotPrinter) GetNextPageUpdate() int {
+func (n *NiimbotPrinter) GetNextPageUpdate(ctx context.Context) (int, error) {
 	logger.LogDebug("Getting print status")
-    var pkt *packets.NiimbotPacket
-
-    for i := 0; i < 300; i++ {
-        pkt = n.SerialSocket.WaitUntilCode(packets.NiimbotD11ResponseCodePacket.PAGE_PRINT_DONE)
-        if pkt !=  nil {
-            break
-        }
-        time.Sleep(100 * time.Millisecond)
-    }
-    logger.LogDebug("Received page print done packet", pkt.ToBytes())
-    return int(pkt.Data[1])
+	pkt, err := n.dispatcher.request(ctx, packets.NiimbotD11ResponseCodePacket.PAGE_PRINT_DONE, n.PageTimeout)
+	if err != nil {
+		return 0, err
+	}
+	done, err := packets.ParsePagePrintDone(pkt)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	logger.LogDebug("Received page print done packet", pkt.ToBytes())
+	return done.Page, nil
 }
 
-func (n *NiimbotPrinter) SendImage(pkts []packets.NiimbotPacket) bool {
+func (n *NiimbotPrinter) SendImage(ctx context.Context, rows []packets.Request) (bool, error) {
+	if err := checkRows(rows); err != nil {
+		return false, err
+	}
 	logger.LogDebug("Sending image")
-	pkt := n.SerialSocket.TranscieveBlock(packets.NiimbotD11RequestCodePacket.IMAGE_CONFIRM, pkts, 0)
+	pkt, err := n.transcieveBlock(ctx, rows)
+	if err != nil {
+		return false, err
+	}
 	if pkt == nil {
-		panic("Error sending image")
+		return false, ErrEmptyResponse
+	}
+	confirmation, err := packets.ParseConfirmation(pkt)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
 	}
-	return int(pkt.Data[0]) != 0
+	return confirmation.OK, nil
 }
 
-func (n *NiimbotPrinter) WaitPrintFinish(pageNumber int) bool {
-    for {
-        currentPage := n.GetNextPageUpdate()
-        if currentPage == pageNumber {
-            break
-        }
-    }
+// checkRows makes sure every row fits its packet: row and pixel positions
+// are shorts and the repeat count a byte.
+func checkRows(rows []packets.Request) error {
+	for _, req := range rows {
+		row, ok := req.(packets.ImageRow)
+		if !ok {
+			return fmt.Errorf("%w: request %d is not an image row", ErrInvalidImage, req.Code())
+		}
+		y, repeat := row.Span()
+		if !helpers.ValidShort(y) || repeat < 1 || repeat > 255 {
+			return fmt.Errorf("%w: row %d repeated %d times", ErrInvalidImage, y, repeat)
+		}
+		if setImage, ok := req.(packets.SetImage); ok {
+			for _, x := range setImage.Indexes {
+				if !helpers.ValidShort(x) {
+					return fmt.Errorf("%w: row %d pixel %d", ErrInvalidImage, y, x)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (n *NiimbotPrinter) WaitPrintFinish(ctx context.Context, pageNumber int) error {
+	for {
+		currentPage, err := n.GetNextPageUpdate(ctx)
+		if err != nil {
+			return err
+		}
+		if currentPage == pageNumber {
+			return nil
+		}
+	}
+}
 
-    return true
+// PrintLabel prints quantity copies of img. A labelDensity of 0 uses the
+// default density of the printer's profile.
+func (n *NiimbotPrinter) PrintLabel(ctx context.Context, img image.Image, labelType int, labelDensity int, quantity int) error {
+	options := DefaultPrintOptions()
+	options.LabelType = labelType
+	options.LabelDensity = labelDensity
+	options.Quantity = quantity
+	return n.PrintLabelWithOptions(ctx, img, options)
 }
 
-func (n *NiimbotPrinter) PrintLabel(img image.Image, labelType int, labelDensity int, quantity int) {
-	if img.Bounds().Dx() > 96 || img.Bounds().Dy() > 330 {
-		logger.LogError("Image cannot have more than 96px width and 330px height")
-		return
+func (n *NiimbotPrinter) PrintLabelWithOptions(ctx context.Context, img image.Image, options PrintOptions) error {
+	// Checked before anything is sent, so a bad quantity never starts a job
+	if options.Quantity < 1 || options.Quantity > 65535 {
+		return fmt.Errorf("%w: %d", ErrInvalidQuantity, options.Quantity)
+	}
+	if n.Profile == nil {
+		if _, err := n.DetectProfile(ctx); err != nil {
+			return err
+		}
+	}
+	profile := n.profile()
+	if options.LabelDensity == 0 {
+		options.LabelDensity = profile.DensityDefault
 	}
 
-	if img.Bounds().Dx()/img.Bounds().Dy() > 1 {
-		logger.LogError("Image must have portrait orientation")
-		return
+	img = options.prepare(img, profile)
+
+	if img.Bounds().Dx() > profile.PrintheadDots || img.Bounds().Dy() > profile.MaxLength {
+		return fmt.Errorf("%w: %s images cannot have more than %dpx width and %dpx height", ErrInvalidImage, profile.Model, profile.PrintheadDots, profile.MaxLength)
 	}
 
-	imagePackets := image_encoder.EncodeForPrintingWithConfirmation(img)
+	imagePackets := image_encoder.EncodeWithOptions(img, options.Image)
 
-	n.SetLabelType(labelType)
-	n.SetLabelDensity(labelDensity)
-	n.StartPrint()
-	n.AllowPrintClear()
+	if err := n.checkReady(ctx); err != nil {
+		return err
+	}
+	if _, err := n.SetLabelType(ctx, options.LabelType); err != nil {
+		return err
+	}
+	if _, err := n.SetLabelDensity(ctx, options.LabelDensity); err != nil {
+		return err
+	}
+	if err := n.startPrint(ctx, options.Quantity); err != nil {
+		return err
+	}
 
-	n.StartPagePrint()
+	if err := n.printPage(ctx, img.Bounds().Dx(), img.Bounds().Dy(), imagePackets, options.Quantity); err != nil {
+		n.abortPrint()
+		return err
+	}
+	if _, err := n.EndPrint(ctx); err != nil {
+		return err
+	}
 
-	n.SetDimension(img.Bounds().Dx(), img.Bounds().Dy())
-	n.SetQuantity(quantity)
-	n.SendImage(imagePackets)
+	logger.LogInfo("Printed", options.Quantity, "labels")
+	return nil
+}
 
-	n.EndPagePrint()
+func (n *NiimbotPrinter) startPrint(ctx context.Context, totalPages int) error {
+	var err error
+	if n.profile().Quirks.PrintStartWithPages {
+		_, err = n.StartPrintWithPages(ctx, totalPages)
+	} else {
+		_, err = n.StartPrint(ctx)
+	}
+	return err
+}
 
-	n.WaitPrintFinish(quantity)
-	n.EndPrint()
+// checkReady fails early when the lid is open or the labels ran out, instead
+// of letting the job hang after the image was sent.
+func (n *NiimbotPrinter) checkReady(ctx context.Context) error {
+	status, err := n.Heartbeat(ctx)
+	if skipUnsupported(err) != nil {
+		return err
+	}
+	if err != nil {
+		logger.LogDebug("Printer does not support heartbeat, skipping status check", err)
+		return nil
+	}
+	logger.LogDebug("Printer status", status)
+	return status.Ready()
+}
+
+func (n *NiimbotPrinter) printPage(ctx context.Context, width int, height int, imagePackets []packets.Request, quantity int) error {
+	if _, err := n.AllowPrintClear(ctx); err != nil {
+		return err
+	}
+	if _, err := n.StartPagePrint(ctx); err != nil {
+		return err
+	}
+	if n.profile().Quirks.DimensionWithQuantity {
+		if _, err := n.SetDimensionWithCopies(ctx, width, height, quantity); err != nil {
+			return err
+		}
+	} else {
+		if _, err := n.SetDimension(ctx, width, height); err != nil {
+			return err
+		}
+		if _, err := n.SetQuantity(ctx, quantity); err != nil {
+			return err
+		}
+	}
+
+	// Page notifications can arrive before EndPagePrint returns, listen first
+	events, unsubscribe := n.Subscribe()
+	defer unsubscribe()
 
-    logger.LogInfo("Printed", quantity, "labels")
+	if _, err := n.SendImage(ctx, imagePackets); err != nil {
+		return err
+	}
+	if _, err := n.EndPagePrint(ctx); err != nil {
+		return err
+	}
+	return n.waitPagesPrinted(ctx, events, quantity)
+}
+
+func (n *NiimbotPrinter) waitPagesPrinted(ctx context.Context, events <-chan packets.NiimbotPacket, quantity int) error {
+	for {
+		pageCtx, cancel := context.WithTimeout(ctx, n.PageTimeout)
+		select {
+		case pkt, ok := <-events:
+			cancel()
+			if !ok {
+				return ErrClosed
+			}
+			if int(pkt.Type) != packets.NiimbotD11ResponseCodePacket.PAGE_PRINT_DONE {
+				continue
+			}
+			done, err := packets.ParsePagePrintDone(&pkt)
+			if err != nil {
+				logger.LogDebug("Ignoring invalid page print done packet", pkt.ToBytes())
+				continue
+			}
+			logger.LogDebug("Received page print done packet", pkt.ToBytes())
+			if done.Page == quantity {
+				return nil
+			}
+		case <-pageCtx.Done():
+			cancel()
+			return contextError(pageCtx.Err())
+		}
+	}
+}
+
+// abortPrint ends a print job that failed or was cancelled half way, so the
+// printer does not stay waiting for image data. It uses its own context
+// because the job's context may already be done.
+func (n *NiimbotPrinter) abortPrint() {
+	ctx, cancel := context.WithTimeout(context.Background(), n.ResponseTimeout)
+	defer cancel()
+	if _, err := n.EndPrint(ctx); err != nil {
+		logger.LogDebug("Error ending aborted print", err)
+	}
 }
@@ -0,0 +1,77 @@
+package niimbot
+
+import (
+	"image"
+	"math"
+
+	image_encoder "github.com/matheustavarestrindade/niimprintgo/internal/app/image"
+)
+
+// PrintOptions configures a print job. A LabelDensity of 0 uses the default
+// density of the printer's profile.
+type PrintOptions struct {
+	LabelType    int
+	LabelDensity int
+	Quantity     int
+	// LabelWidth and LabelHeight are the label size in dots the image is
+	// fitted to, across the printhead and along the feed. When 0 the width
+	// is the printhead's and the height follows from the image, see
+	// labelSize.
+	LabelWidth  int
+	LabelHeight int
+	Image       image_encoder.Options
+}
+
+func DefaultPrintOptions() PrintOptions {
+	return PrintOptions{
+		LabelType: 1,
+		Quantity:  1,
+		Image:     image_encoder.DefaultOptions(),
+	}
+}
+
+// labelSize returns the size img is fitted to. With FitNone a missing side
+// is the image's own, otherwise a missing height is the one img has once
+// scaled to the label width, limited to the profile's maximum length.
+// FitContain only enlarges img with Options.Upscale.
+func (options PrintOptions) labelSize(img image.Image, profile *Profile) (int, int) {
+	imgWidth, imgHeight := img.Bounds().Dx(), img.Bounds().Dy()
+	width, height := options.LabelWidth, options.LabelHeight
+
+	if options.Image.Fit == image_encoder.FitNone {
+		if width == 0 {
+			width = imgWidth
+		}
+		if height == 0 {
+			height = imgHeight
+		}
+		return width, height
+	}
+
+	if width == 0 {
+		width = profile.PrintheadDots
+	}
+	if height == 0 && imgWidth > 0 {
+		scale := float64(width) / float64(imgWidth)
+		if options.Image.Fit == image_encoder.FitContain && !options.Image.Upscale {
+			scale = math.Min(scale, 1)
+		}
+		height = min(int(math.Round(float64(imgHeight)*scale)), profile.MaxLength)
+	}
+	return width, height
+}
+
+// prepare rotates img to the feed direction and fits it to the label.
+func (options PrintOptions) prepare(img image.Image, profile *Profile) image.Image {
+	img = image_encoder.Rotate(img, options.Image.Rotation)
+	width, height := options.labelSize(img, profile)
+	return image_encoder.Fit(img, width, height, options.Image)
+}
+
+// Preview returns img as profile would print it, turned back to the
+// orientation it was designed in.
+func (options PrintOptions) Preview(img image.Image, profile *Profile) image.Image {
+	rotation := options.Image.Rotation.Resolve(img)
+	label := image_encoder.Binarize(options.prepare(img, profile), options.Image)
+	return image_encoder.Rotate(label, rotation.Inverse())
+}
@@ -0,0 +1,74 @@
+package niimbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+	serialsocket "github.com/matheustavarestrindade/niimprintgo/internal/app/socket"
+	"go.bug.st/serial"
+)
+
+var ErrNoBaudRate = errors.New("No baud rate got a response from the printer")
+
+// ProbeTimeout bounds how long each probe waits for the printer to answer.
+var ProbeTimeout = 500 * time.Millisecond
+
+// ProbeBaudRate opens comPort with mode at each of the given baud rates and
+// returns the first one where a GET_INFO request gets a framed response.
+func ProbeBaudRate(ctx context.Context, comPort string, mode serial.Mode, baudRates []int) (int, error) {
+	for _, baudRate := range baudRates {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		mode.BaudRate = baudRate
+		logger.LogDebug("Probing", comPort, "at", baudRate, "baud")
+
+		err := probe(ctx, comPort, mode)
+		if err == nil {
+			return baudRate, nil
+		}
+		logger.LogDebug("No response at", baudRate, "baud", err)
+	}
+	return 0, fmt.Errorf("%w on %s", ErrNoBaudRate, comPort)
+}
+
+// ConnectAutoBaud probes the baud rates and returns a printer connected at
+// the first one that works.
+func ConnectAutoBaud(ctx context.Context, comPort string, mode serial.Mode, baudRates []int) (*NiimbotPrinter, error) {
+	baudRate, err := ProbeBaudRate(ctx, comPort, mode, baudRates)
+	if err != nil {
+		return nil, err
+	}
+	mode.BaudRate = baudRate
+	return NewNiimbotPrinterWithMode(comPort, mode)
+}
+
+func probe(ctx context.Context, comPort string, mode serial.Mode) error {
+	printer, err := openProbe(comPort, mode)
+	if err != nil {
+		return err
+	}
+	defer printer.Close()
+
+	_, err = printer.getInfo(ctx, packets.NiimbotD11InfoPacket.DEVICETYPE)
+	// Error replies are framed too, so something that speaks the protocol is there
+	if errors.Is(err, ErrIllegalArgument) || errors.Is(err, ErrNotImplement) {
+		return nil
+	}
+	return err
+}
+
+// openProbe connects without logging and with the short probe timeout.
+func openProbe(comPort string, mode serial.Mode) (*NiimbotPrinter, error) {
+	socket := serialsocket.NewSerialSocketWithMode(comPort, mode)
+	if err := socket.Connect(); err != nil {
+		return nil, err
+	}
+	printer := NewNiimbotPrinterWithTransport(socket)
+	printer.ResponseTimeout = ProbeTimeout
+	return printer, nil
+}
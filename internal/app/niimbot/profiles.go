@@ -0,0 +1,213 @@
+package niimbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+)
+
+// Quirks are the places where a model's protocol differs from the D11.
+type Quirks struct {
+	// PrintStartWithPages sends the total page count with START_PRINT
+	PrintStartWithPages bool
+	// DimensionWithQuantity sends the copy count with SET_DIMENSION instead
+	// of a separate SET_QUANTITY
+	DimensionWithQuantity bool
+}
+
+// Profile describes what a printer model can print. Sizes are in dots, the
+// printhead runs across the label width.
+type Profile struct {
+	Model          string
+	DeviceTypes    []int
+	PrintheadDots  int
+	DPI            int
+	MaxLength      int
+	DensityMin     int
+	DensityMax     int
+	DensityDefault int
+	// AutoShutdownMin and AutoShutdownMax bound the idle time setting, in
+	// steps of 15 minutes
+	AutoShutdownMin int
+	AutoShutdownMax int
+	LabelTypes      map[int]string
+	Quirks          Quirks
+}
+
+var standardLabelTypes = map[int]string{
+	1: "With gaps",
+	2: "Black mark",
+	3: "Continuous",
+}
+
+var Profiles = []*Profile{
+	{
+		Model:           "D11",
+		DeviceTypes:     []int{512},
+		PrintheadDots:   96,
+		DPI:             203,
+		MaxLength:       330,
+		DensityMin:      1,
+		DensityMax:      3,
+		DensityDefault:  2,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+	},
+	{
+		Model:           "D110",
+		DeviceTypes:     []int{2304},
+		PrintheadDots:   96,
+		DPI:             203,
+		MaxLength:       330,
+		DensityMin:      1,
+		DensityMax:      3,
+		DensityDefault:  2,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+	},
+	{
+		Model:           "D101",
+		DeviceTypes:     []int{2560},
+		PrintheadDots:   192,
+		DPI:             203,
+		MaxLength:       330,
+		DensityMin:      1,
+		DensityMax:      3,
+		DensityDefault:  2,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+	},
+	{
+		Model:           "B21",
+		DeviceTypes:     []int{768},
+		PrintheadDots:   384,
+		DPI:             203,
+		MaxLength:       800,
+		DensityMin:      1,
+		DensityMax:      5,
+		DensityDefault:  3,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+	},
+	{
+		Model:           "B18",
+		DeviceTypes:     []int{3584},
+		PrintheadDots:   120,
+		DPI:             203,
+		MaxLength:       1600,
+		DensityMin:      1,
+		DensityMax:      3,
+		DensityDefault:  2,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+		Quirks: Quirks{
+			PrintStartWithPages:   true,
+			DimensionWithQuantity: true,
+		},
+	},
+	{
+		Model:           "B1",
+		DeviceTypes:     []int{4096},
+		PrintheadDots:   384,
+		DPI:             203,
+		MaxLength:       800,
+		DensityMin:      1,
+		DensityMax:      5,
+		DensityDefault:  3,
+		AutoShutdownMin: 1,
+		AutoShutdownMax: 4,
+		LabelTypes:      standardLabelTypes,
+		Quirks: Quirks{
+			PrintStartWithPages:   true,
+			DimensionWithQuantity: true,
+		},
+	},
+}
+
+// DefaultProfile is used when the printer reports a device type that is not
+// in Profiles.
+var DefaultProfile = Profiles[0]
+
+func ProfileForDeviceType(deviceType int) (*Profile, bool) {
+	for _, profile := range Profiles {
+		for _, t := range profile.DeviceTypes {
+			if t == deviceType {
+				return profile, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ProfileByModel finds a profile by model name, ignoring case.
+func ProfileByModel(model string) (*Profile, bool) {
+	for _, profile := range Profiles {
+		if strings.EqualFold(profile.Model, model) {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// ModelName returns the model reported by the GET_INFO DEVICETYPE key.
+func ModelName(deviceType int) string {
+	if profile, ok := ProfileForDeviceType(deviceType); ok {
+		return profile.Model
+	}
+	return fmt.Sprintf("Unknown (%d)", deviceType)
+}
+
+func (p *Profile) ValidDensity(density int) error {
+	if density < p.DensityMin || density > p.DensityMax {
+		return fmt.Errorf("%w: %d, %s supports %d to %d", ErrInvalidDensity, density, p.Model, p.DensityMin, p.DensityMax)
+	}
+	return nil
+}
+
+func (p *Profile) ValidAutoShutdown(value int) error {
+	if value < p.AutoShutdownMin || value > p.AutoShutdownMax {
+		return fmt.Errorf("%w: auto shutdown time %d, %s supports %d to %d", ErrInvalidSetting, value, p.Model, p.AutoShutdownMin, p.AutoShutdownMax)
+	}
+	return nil
+}
+
+func (p *Profile) ValidLabelType(labelType int) error {
+	if _, ok := p.LabelTypes[labelType]; !ok {
+		return fmt.Errorf("%w: %d is not a %s label type", ErrInvalidLabelType, labelType, p.Model)
+	}
+	return nil
+}
+
+// DetectProfile sets Profile from the device type the printer reports,
+// falling back to DefaultProfile for unknown or silent printers.
+func (n *NiimbotPrinter) DetectProfile(ctx context.Context) (*Profile, error) {
+	deviceType, err := n.GetDeviceType(ctx)
+	if skipUnsupported(err) != nil {
+		return nil, err
+	}
+
+	profile, ok := ProfileForDeviceType(deviceType)
+	if err != nil || !ok {
+		logger.LogInfo("Unknown printer model", deviceType, "using the", DefaultProfile.Model, "profile")
+		profile = DefaultProfile
+	}
+	logger.LogDebug("Using printer profile", profile.Model)
+	n.Profile = profile
+	return profile, nil
+}
+
+// profile returns the detected or configured profile, DefaultProfile when
+// there is none yet.
+func (n *NiimbotPrinter) profile() *Profile {
+	if n.Profile == nil {
+		return DefaultProfile
+	}
+	return n.Profile
+}
@@ -0,0 +1,54 @@
+package niimbot
+
+import (
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// ProtocolError is a failure reported by the printer itself. It matches
+// ErrIllegalArgument or ErrNotImplement with errors.Is depending on the
+// response code.
+type ProtocolError struct {
+	// RequestCode is the command the error was attributed to, the one sent
+	// last as the printer does not say
+	RequestCode  int
+	ResponseCode int
+	Payload      []byte
+}
+
+func (e *ProtocolError) Error() string {
+	request := "the pending request"
+	if e.RequestCode >= 0 {
+		request = fmt.Sprintf("request %d", e.RequestCode)
+	}
+
+	var message string
+	switch e.ResponseCode {
+	case packets.NiimbotD11ResponseCodePacket.ILLEGAL_ARGUMENT:
+		message = fmt.Sprintf("Printer rejected the arguments of %s", request)
+	case packets.NiimbotD11ResponseCodePacket.NOT_IMPLEMENT:
+		message = fmt.Sprintf("Printer firmware does not implement %s", request)
+	default:
+		message = fmt.Sprintf("Printer reported error %d for %s", e.ResponseCode, request)
+	}
+	if len(e.Payload) > 0 {
+		message = fmt.Sprintf("%s, payload %v", message, e.Payload)
+	}
+	return message
+}
+
+func (e *ProtocolError) Is(target error) bool {
+	switch target {
+	case ErrIllegalArgument:
+		return e.ResponseCode == packets.NiimbotD11ResponseCodePacket.ILLEGAL_ARGUMENT
+	case ErrNotImplement:
+		return e.ResponseCode == packets.NiimbotD11ResponseCodePacket.NOT_IMPLEMENT
+	}
+	return false
+}
+
+func isErrorResponse(code int) bool {
+	responses := packets.NiimbotD11ResponseCodePacket
+	return code == responses.ILLEGAL_ARGUMENT || code == responses.NOT_IMPLEMENT
+}
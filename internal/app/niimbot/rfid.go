@@ -0,0 +1,78 @@
+package niimbot
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+var ErrNoRFIDTag = errors.New("No RFID tag found on the label roll")
+
+// RFIDInfo is the tag of the label roll loaded in the printer. Lengths are
+// counted in labels.
+type RFIDInfo struct {
+	UUID        string
+	Barcode     string
+	Serial      string
+	TotalLength int
+	UsedLength  int
+	LabelType   int
+}
+
+// ReadRFID reads the label roll tag, returning ErrNoRFIDTag when the printer
+// finds none.
+func (n *NiimbotPrinter) ReadRFID(ctx context.Context) (*RFIDInfo, error) {
+	logger.LogDebug("Reading RFID")
+	pkt, err := n.transcieve(ctx, packets.GetRFID{})
+	if err != nil {
+		return nil, err
+	}
+	return parseRFID(pkt.Data)
+}
+
+func parseRFID(data []byte) (*RFIDInfo, error) {
+	if len(data) == 0 || data[0] == 0 {
+		return nil, ErrNoRFIDTag
+	}
+	if len(data) < 9 {
+		return nil, fmt.Errorf("%w: RFID payload too short", ErrInvalidResponse)
+	}
+
+	info := &RFIDInfo{
+		UUID: hex.EncodeToString(data[0:8]),
+	}
+	index := 8
+
+	readString := func() (string, bool) {
+		if index >= len(data) {
+			return "", false
+		}
+		length := int(data[index])
+		index++
+		if index+length > len(data) {
+			return "", false
+		}
+		value := string(data[index : index+length])
+		index += length
+		return value, true
+	}
+
+	var ok bool
+	if info.Barcode, ok = readString(); !ok {
+		return nil, fmt.Errorf("%w: RFID barcode truncated", ErrInvalidResponse)
+	}
+	if info.Serial, ok = readString(); !ok {
+		return nil, fmt.Errorf("%w: RFID serial truncated", ErrInvalidResponse)
+	}
+	if len(data)-index < 5 {
+		return nil, fmt.Errorf("%w: RFID lengths truncated", ErrInvalidResponse)
+	}
+	info.TotalLength = decodeInt(data[index : index+2])
+	info.UsedLength = decodeInt(data[index+2 : index+4])
+	info.LabelType = int(data[index+4])
+	return info, nil
+}
@@ -0,0 +1,88 @@
+package niimbot
+
+import (
+	"errors"
+	"testing"
+)
+
+// rfidTag builds a GET_RFID payload: UUID, length prefixed barcode and
+// serial, total and used lengths and the label type.
+func rfidTag(barcode, serial string, total, used, labelType int) []byte {
+	data := []byte{0x88, 0x1d, 0x5a, 0x3c, 0x00, 0x00, 0x00, 0x01}
+	data = append(data, byte(len(barcode)))
+	data = append(data, barcode...)
+	data = append(data, byte(len(serial)))
+	data = append(data, serial...)
+	data = append(data, byte(total>>8), byte(total), byte(used>>8), byte(used), byte(labelType))
+	return data
+}
+
+func TestParseRFID(t *testing.T) {
+	full := rfidTag("6972842743589", "PZ1G1234567", 230, 17, 1)
+	// Offset of the serial length, right after the barcode
+	serial := 8 + 1 + len("6972842743589")
+
+	tests := []struct {
+		name string
+		data []byte
+		want *RFIDInfo
+		err  error
+	}{
+		{
+			name: "full tag",
+			data: full,
+			want: &RFIDInfo{
+				UUID:        "881d5a3c00000001",
+				Barcode:     "6972842743589",
+				Serial:      "PZ1G1234567",
+				TotalLength: 230,
+				UsedLength:  17,
+				LabelType:   1,
+			},
+		},
+		{
+			name: "empty strings",
+			data: rfidTag("", "", 0x1234, 0, 3),
+			want: &RFIDInfo{UUID: "881d5a3c00000001", TotalLength: 0x1234, LabelType: 3},
+		},
+		{name: "blank tag", data: []byte{0x00}, err: ErrNoRFIDTag},
+		{name: "blank tag with padding", data: []byte{0x00, 0xff, 0xff}, err: ErrNoRFIDTag},
+		{name: "empty payload", data: nil, err: ErrNoRFIDTag},
+		{name: "UUID only", data: full[:8], err: ErrInvalidResponse},
+		{name: "barcode truncated", data: full[:12], err: ErrInvalidResponse},
+		{name: "serial length missing", data: full[:serial], err: ErrInvalidResponse},
+		{name: "serial truncated", data: full[:serial+4], err: ErrInvalidResponse},
+		{name: "lengths truncated", data: full[:len(full)-1], err: ErrInvalidResponse},
+		{name: "barcode longer than the payload", data: append(full[:8:8], 0xff, 'a'), err: ErrInvalidResponse},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := parseRFID(test.data)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("got %v, want %v", err, test.err)
+				}
+				if info != nil {
+					t.Errorf("got %+v with the error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *info != *test.want {
+				t.Errorf("got %+v, want %+v", *info, *test.want)
+			}
+		})
+	}
+}
+
+func TestParseRFIDEveryTruncation(t *testing.T) {
+	full := rfidTag("6972842743589", "PZ1G1234567", 230, 17, 1)
+	for n := 1; n < len(full); n++ {
+		if info, err := parseRFID(full[:n]); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("first %d bytes: got %+v %v, want ErrInvalidResponse", n, info, err)
+		}
+	}
+}
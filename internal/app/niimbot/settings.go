@@ -0,0 +1,23 @@
+package niimbot
+
+import (
+	"context"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// SetAutoShutdownTime sets how long the printer stays on while idle, in
+// steps of 15 minutes within the range of its profile.
+func (n *NiimbotPrinter) SetAutoShutdownTime(ctx context.Context, value int) (bool, error) {
+	if n.Profile == nil {
+		if _, err := n.DetectProfile(ctx); err != nil {
+			return false, err
+		}
+	}
+	if err := n.profile().ValidAutoShutdown(value); err != nil {
+		return false, err
+	}
+	logger.LogDebug("Setting auto shutdown time", value)
+	return n.sendCodeAndConfirm(ctx, packets.SetAutoShutdown{Time: value})
+}
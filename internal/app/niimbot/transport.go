@@ -0,0 +1,57 @@
+package niimbot
+
+import (
+	"context"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/packets"
+)
+
+// Transport is the link the printer talks over. ReceivePacket blocks for at
+// most the transport's read window and returns a nil packet and no error when
+// nothing arrived. A corrupted frame is returned as ErrInvalidChecksum and
+// any other error ends the connection. Once Close is called ReceivePacket
+// must return an error.
+type Transport interface {
+	SendPacket(pkt *packets.NiimbotPacket) error
+	ReceivePacket() (*packets.NiimbotPacket, error)
+	Close() error
+}
+
+func (n *NiimbotPrinter) transcieve(ctx context.Context, req packets.Request) (*packets.NiimbotPacket, error) {
+	logger.LogDebug("Transcieve ", req.Code(), req)
+	logger.LogDebug("Waiting for response code", req.ResponseCode())
+	pkt, err := packets.RequestPacket(req)
+	if err != nil {
+		return nil, err
+	}
+	return n.dispatcher.request(ctx, req.ResponseCode(), n.ResponseTimeout, pkt)
+}
+
+// transcieveBlock sends reqs back to back and waits for the response of the
+// last one.
+func (n *NiimbotPrinter) transcieveBlock(ctx context.Context, reqs []packets.Request) (*packets.NiimbotPacket, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	responseCode := reqs[len(reqs)-1].ResponseCode()
+	logger.LogDebug("TranscieveBlock ", len(reqs), "requests")
+	logger.LogDebug("Waiting for response code", responseCode)
+
+	block := make([]packets.NiimbotPacket, len(reqs))
+	for i, req := range reqs {
+		pkt, err := packets.RequestPacket(req)
+		if err != nil {
+			return nil, err
+		}
+		block[i] = pkt
+	}
+	return n.dispatcher.request(ctx, responseCode, n.ResponseTimeout, block...)
+}
+
+// Subscribe returns a channel that receives every packet no pending request
+// claimed, such as PAGE_PRINT_DONE notifications. The channel is closed when
+// the returned function is called or the connection is lost.
+func (n *NiimbotPrinter) Subscribe() (<-chan packets.NiimbotPacket, func()) {
+	return n.dispatcher.subscribe()
+}
@@ -0,0 +1,112 @@
+package packets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var frameStart = []byte{0x55, 0x55}
+
+// Framer splits a byte stream into NiimbotPackets. It uses the length byte to
+// find the end of each frame, keeps partial frames between writes and skips
+// garbage until the next valid frame.
+type Framer struct {
+	buffer []byte
+}
+
+func NewFramer() *Framer {
+	return &Framer{
+		buffer: make([]byte, 0, 1024),
+	}
+}
+
+func (f *Framer) Write(data []byte) (int, error) {
+	f.buffer = append(f.buffer, data...)
+	return len(data), nil
+}
+
+// Next returns the next complete packet, or nil when more bytes are needed.
+// A frame whose length and end marker check out but whose checksum does not
+// is dropped and reported as ErrInvalidChecksum, the following call goes on
+// with the bytes after it.
+func (f *Framer) Next() (*NiimbotPacket, error) {
+	for {
+		start := bytes.Index(f.buffer, frameStart)
+		if start < 0 {
+			// Keep a trailing start byte, its pair may be in the next read
+			if len(f.buffer) > 0 && f.buffer[len(f.buffer)-1] == frameStart[0] {
+				f.consume(len(f.buffer) - 1)
+			} else {
+				f.consume(len(f.buffer))
+			}
+			return nil, nil
+		}
+		f.consume(start)
+
+		if len(f.buffer) < 4 {
+			return nil, nil
+		}
+		size := 4 + int(f.buffer[3]) + 3
+		if len(f.buffer) < size {
+			// A stray 0x55 before a real header makes a false one whose length
+			// may run far past the real frame, which would hold it back
+			if next := f.nextFrame(); next > 0 {
+				f.consume(next)
+				continue
+			}
+			return nil, nil
+		}
+
+		frame := make([]byte, size)
+		copy(frame, f.buffer[:size])
+		pkt, err := parse(frame)
+		if errors.Is(err, ErrInvalidChecksum) {
+			f.consume(size)
+			return nil, fmt.Errorf("%w: frame %x", err, frame)
+		}
+		if err != nil {
+			// Not a real frame start, resync from the next byte
+			f.consume(1)
+			continue
+		}
+		f.consume(size)
+		return pkt, nil
+	}
+}
+
+// nextFrame returns the offset of the first complete, valid frame after the
+// start of the buffer, 0 when there is none yet.
+func (f *Framer) nextFrame() int {
+	for i := 1; i+4 <= len(f.buffer); i++ {
+		if f.buffer[i] != frameStart[0] || f.buffer[i+1] != frameStart[1] {
+			continue
+		}
+		size := 4 + int(f.buffer[i+3]) + 3
+		if i+size > len(f.buffer) {
+			continue
+		}
+		if _, err := parse(f.buffer[i : i+size]); err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+// Resync drops the frame start Next is waiting on so the following call
+// looks for the next one. Use it when the line goes quiet in the middle of a
+// frame, which means its header was garbage.
+func (f *Framer) Resync() {
+	if len(f.buffer) > 0 {
+		f.consume(1)
+	}
+}
+
+// Buffered returns the number of bytes waiting for the rest of their frame.
+func (f *Framer) Buffered() int {
+	return len(f.buffer)
+}
+
+func (f *Framer) consume(n int) {
+	f.buffer = append(f.buffer[:0], f.buffer[n:]...)
+}
@@ -0,0 +1,187 @@
+package packets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func frame(pktType byte, data ...byte) []byte {
+	pkt := NiimbotPacket{Type: pktType, Data: data}
+	return pkt.ToBytes()
+}
+
+// badChecksum flips the checksum of a frame.
+func badChecksum(frame []byte) []byte {
+	frame[len(frame)-3] ^= 0xff
+	return frame
+}
+
+func join(chunks ...[]byte) []byte {
+	return bytes.Join(chunks, nil)
+}
+
+// split cuts data into chunks of n bytes.
+func split(data []byte, n int) [][]byte {
+	var chunks [][]byte
+	for len(data) > n {
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return append(chunks, data)
+}
+
+func TestFramerNext(t *testing.T) {
+	tail := frame(0x85, 0xaa, 0xaa, 0x01, 0xaa)
+	long := make([]byte, 200)
+	for i := range long {
+		long[i] = byte(i)
+	}
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   []NiimbotPacket
+		// corrupted is the number of frames reported as ErrInvalidChecksum
+		corrupted int
+	}{
+		{
+			name:   "one frame",
+			chunks: [][]byte{frame(0x40, 1, 2)},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1, 2}}},
+		},
+		{
+			name:   "payload with the end marker",
+			chunks: [][]byte{tail},
+			want:   []NiimbotPacket{{Type: 0x85, Data: []byte{0xaa, 0xaa, 0x01, 0xaa}}},
+		},
+		{
+			name:   "payload with the start marker",
+			chunks: [][]byte{frame(0x85, 0x55, 0x55, 0x00, 0x55)},
+			want:   []NiimbotPacket{{Type: 0x85, Data: []byte{0x55, 0x55, 0x00, 0x55}}},
+		},
+		{
+			name:   "split byte by byte",
+			chunks: split(tail, 1),
+			want:   []NiimbotPacket{{Type: 0x85, Data: []byte{0xaa, 0xaa, 0x01, 0xaa}}},
+		},
+		{
+			name:   "split across several writes",
+			chunks: split(frame(0x85, long...), 7),
+			want:   []NiimbotPacket{{Type: 0x85, Data: long}},
+		},
+		{
+			name:   "two frames in one write",
+			chunks: [][]byte{join(frame(0x40, 1), frame(0x41, 2))},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1}}, {Type: 0x41, Data: []byte{2}}},
+		},
+		{
+			name:   "garbage before a header",
+			chunks: [][]byte{join([]byte{0x00, 0xaa, 0xaa, 0x13, 0x55}, frame(0x40, 1))},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1}}},
+		},
+		{
+			name:   "garbage split from its frame",
+			chunks: [][]byte{{0x12, 0x55}, join([]byte{0x34}, frame(0x40, 1)[:3]), frame(0x40, 1)[3:]},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1}}},
+		},
+		{
+			name:   "stray start byte before a header",
+			chunks: [][]byte{join([]byte{0x55}, frame(0x40, 1))},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1}}},
+		},
+		{
+			name:   "false header with a long length",
+			chunks: [][]byte{join([]byte{0x55, 0x55, 0x00, 0xff}, frame(0x40, 1))},
+			want:   []NiimbotPacket{{Type: 0x40, Data: []byte{1}}},
+		},
+		{
+			name:      "bad checksum",
+			chunks:    [][]byte{join(badChecksum(frame(0x40, 1, 2)), frame(0x41, 2))},
+			want:      []NiimbotPacket{{Type: 0x41, Data: []byte{2}}},
+			corrupted: 1,
+		},
+		{
+			name:   "truncated frame then a good one",
+			chunks: [][]byte{join(frame(0x40, 1, 2)[:5], frame(0x41, 2))},
+			want:   []NiimbotPacket{{Type: 0x41, Data: []byte{2}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			framer := NewFramer()
+			var got []*NiimbotPacket
+			corrupted := 0
+			for _, chunk := range test.chunks {
+				framer.Write(chunk)
+				for {
+					pkt, err := framer.Next()
+					if errors.Is(err, ErrInvalidChecksum) {
+						corrupted++
+						continue
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if pkt == nil {
+						break
+					}
+					got = append(got, pkt)
+				}
+			}
+			if corrupted != test.corrupted {
+				t.Errorf("got %d corrupted frames, want %d", corrupted, test.corrupted)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d packets, want %d", len(got), len(test.want))
+			}
+			for i, pkt := range got {
+				if pkt.Type != test.want[i].Type || !bytes.Equal(pkt.Data, test.want[i].Data) {
+					t.Errorf("packet %d is %s, want %s", i, pkt.ToString(), test.want[i].ToString())
+				}
+			}
+			if framer.Buffered() != 0 {
+				t.Errorf("%d bytes left in the buffer", framer.Buffered())
+			}
+		})
+	}
+}
+
+func TestFramerKeepsPartialFrame(t *testing.T) {
+	data := frame(0x40, 1, 2, 3)
+	framer := NewFramer()
+	framer.Write(data[:len(data)-1])
+	if pkt, err := framer.Next(); pkt != nil || err != nil {
+		t.Fatalf("got %v %v from a partial frame", pkt, err)
+	}
+	if framer.Buffered() != len(data)-1 {
+		t.Fatalf("buffered %d bytes, want %d", framer.Buffered(), len(data)-1)
+	}
+
+	framer.Write(data[len(data)-1:])
+	if pkt, err := framer.Next(); pkt == nil || err != nil {
+		t.Fatalf("frame was not completed by the last byte: %v", err)
+	}
+}
+
+func TestFramerResync(t *testing.T) {
+	// A false header waiting for more bytes than will ever come
+	framer := NewFramer()
+	framer.Write([]byte{0x55, 0x55, 0x00, 0xff, 0x01})
+	if pkt, err := framer.Next(); pkt != nil || err != nil {
+		t.Fatalf("got %v %v from a false header", pkt, err)
+	}
+
+	framer.Resync()
+	framer.Write(frame(0x40, 1)[:4])
+	if pkt, err := framer.Next(); pkt != nil || err != nil {
+		t.Fatalf("got %v %v from a partial frame", pkt, err)
+	}
+	framer.Write(frame(0x40, 1)[4:])
+	pkt, err := framer.Next()
+	if err != nil || pkt == nil || pkt.Type != 0x40 {
+		t.Fatalf("got %v %v, want the frame after the false header", pkt, err)
+	}
+}
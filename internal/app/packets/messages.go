@@ -0,0 +1,335 @@
+package packets
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/helpers"
+)
+
+var (
+	ErrShortPayload = errors.New("Packet payload is too short")
+	ErrFieldRange   = errors.New("Packet field out of range")
+)
+
+// Request is a command sent to the printer. ResponseCode is the type of the
+// packet the printer answers it with.
+type Request interface {
+	Code() int
+	ResponseCode() int
+	Marshal() ([]byte, error)
+}
+
+func RequestPacket(req Request) (NiimbotPacket, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return NiimbotPacket{}, err
+	}
+	return NiimbotPacket{
+		Type: byte(req.Code()),
+		Data: data,
+	}, nil
+}
+
+type GetInfo struct {
+	Key int
+}
+
+func (r GetInfo) Code() int                { return NiimbotD11RequestCodePacket.GET_INFO }
+func (r GetInfo) ResponseCode() int        { return r.Code() + r.Key }
+func (r GetInfo) Marshal() ([]byte, error) { return byteField("info key", r.Key) }
+
+type GetRFID struct{}
+
+func (r GetRFID) Code() int                { return NiimbotD11RequestCodePacket.GET_RFID }
+func (r GetRFID) ResponseCode() int        { return r.Code() + 1 }
+func (r GetRFID) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+type Heartbeat struct{}
+
+func (r Heartbeat) Code() int                { return NiimbotD11RequestCodePacket.HEARTBEAT }
+func (r Heartbeat) ResponseCode() int        { return r.Code() + 1 }
+func (r Heartbeat) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+type SetLabelType struct {
+	Type int
+}
+
+func (r SetLabelType) Code() int                { return NiimbotD11RequestCodePacket.SET_LABEL_TYPE }
+func (r SetLabelType) ResponseCode() int        { return r.Code() + 16 }
+func (r SetLabelType) Marshal() ([]byte, error) { return byteField("label type", r.Type) }
+
+type SetLabelDensity struct {
+	Density int
+}
+
+func (r SetLabelDensity) Code() int                { return NiimbotD11RequestCodePacket.SET_LABEL_DENSITY }
+func (r SetLabelDensity) ResponseCode() int        { return r.Code() + 16 }
+func (r SetLabelDensity) Marshal() ([]byte, error) { return byteField("density", r.Density) }
+
+type SetAutoShutdown struct {
+	Time int
+}
+
+func (r SetAutoShutdown) Code() int                { return NiimbotD11RequestCodePacket.SET_AUTO_SHUTDOWN }
+func (r SetAutoShutdown) ResponseCode() int        { return r.Code() + 16 }
+func (r SetAutoShutdown) Marshal() ([]byte, error) { return byteField("auto shutdown time", r.Time) }
+
+// StartPrint only carries TotalPages when it is not zero, for models that
+// expect the page count up front.
+type StartPrint struct {
+	TotalPages int
+}
+
+func (r StartPrint) Code() int         { return NiimbotD11RequestCodePacket.START_PRINT }
+func (r StartPrint) ResponseCode() int { return r.Code() + 1 }
+
+func (r StartPrint) Marshal() ([]byte, error) {
+	if r.TotalPages == 0 {
+		return []byte{1}, nil
+	}
+	data, err := short("total pages", r.TotalPages)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, 0, 0, 0, 0, 0), nil
+}
+
+type EndPrint struct{}
+
+func (r EndPrint) Code() int                { return NiimbotD11RequestCodePacket.END_PRINT }
+func (r EndPrint) ResponseCode() int        { return r.Code() + 1 }
+func (r EndPrint) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+type StartPagePrint struct{}
+
+func (r StartPagePrint) Code() int                { return NiimbotD11RequestCodePacket.START_PAGE_PRINT }
+func (r StartPagePrint) ResponseCode() int        { return r.Code() + 1 }
+func (r StartPagePrint) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+type EndPagePrint struct{}
+
+func (r EndPagePrint) Code() int                { return NiimbotD11RequestCodePacket.END_PAGE_PRINT }
+func (r EndPagePrint) ResponseCode() int        { return r.Code() + 1 }
+func (r EndPagePrint) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+type AllowPrintClear struct{}
+
+func (r AllowPrintClear) Code() int                { return NiimbotD11RequestCodePacket.ALLOW_PRINT_CLEAR }
+func (r AllowPrintClear) ResponseCode() int        { return r.Code() + 16 }
+func (r AllowPrintClear) Marshal() ([]byte, error) { return []byte{1}, nil }
+
+// SetDimension only carries Copies when it is not zero, for models that take
+// the copy count here instead of from SetQuantity.
+type SetDimension struct {
+	Width  int
+	Height int
+	Copies int
+}
+
+func (r SetDimension) Code() int         { return NiimbotD11RequestCodePacket.SET_DIMENSION }
+func (r SetDimension) ResponseCode() int { return r.Code() + 1 }
+
+// Marshal sends the height first, the printer feeds labels along it.
+func (r SetDimension) Marshal() ([]byte, error) {
+	fields := []struct {
+		name  string
+		value int
+	}{{"height", r.Height}, {"width", r.Width}, {"copies", r.Copies}}
+	if r.Copies == 0 {
+		fields = fields[:2]
+	}
+
+	data := make([]byte, 0, 2*len(fields))
+	for _, field := range fields {
+		encoded, err := short(field.name, field.value)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+type SetQuantity struct {
+	N int
+}
+
+func (r SetQuantity) Code() int                { return NiimbotD11RequestCodePacket.SET_QUANTITY }
+func (r SetQuantity) ResponseCode() int        { return r.Code() + 1 }
+func (r SetQuantity) Marshal() ([]byte, error) { return short("quantity", r.N) }
+
+// The image rows below are sent as one block. The printer does not answer
+// each row, it sends IMAGE_CONFIRM once the whole image arrived.
+//
+// Every row starts with its index and, except for ImageClear, the number of
+// ink pixels in each 32 pixel chunk of the row, and ends with how many times
+// the row repeats.
+
+// ImageRow is any of the image row requests. Span returns the first row it
+// draws and how many rows it covers.
+type ImageRow interface {
+	Request
+	Span() (int, int)
+}
+
+// SetImage draws a row from the x positions of its ink pixels, which is
+// shorter than a bitmap for sparse rows.
+type SetImage struct {
+	Row     int
+	Counts  []byte
+	Repeat  int
+	Indexes []int
+}
+
+func (r SetImage) Code() int         { return NiimbotD11RequestCodePacket.SET_IMAGE }
+func (r SetImage) ResponseCode() int { return NiimbotD11RequestCodePacket.IMAGE_CONFIRM }
+func (r SetImage) Span() (int, int)  { return r.Row, r.Repeat }
+
+func (r SetImage) Marshal() ([]byte, error) {
+	data, err := rowHeader(r.Row, r.Counts, r.Repeat)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range r.Indexes {
+		encoded, err := short("pixel index", index)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// SetImageData draws a row from a bitmap, most significant bit first.
+type SetImageData struct {
+	Row    int
+	Counts []byte
+	Repeat int
+	Bitmap []byte
+}
+
+func (r SetImageData) Code() int         { return NiimbotD11RequestCodePacket.SET_IMAGE_DATA }
+func (r SetImageData) ResponseCode() int { return NiimbotD11RequestCodePacket.IMAGE_CONFIRM }
+func (r SetImageData) Span() (int, int)  { return r.Row, r.Repeat }
+
+func (r SetImageData) Marshal() ([]byte, error) {
+	data, err := rowHeader(r.Row, r.Counts, r.Repeat)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, r.Bitmap...), nil
+}
+
+// ImageClear sends a row without ink.
+type ImageClear struct {
+	Row    int
+	Repeat int
+}
+
+func (r ImageClear) Code() int         { return NiimbotD11RequestCodePacket.IMAGE_CLEAR }
+func (r ImageClear) ResponseCode() int { return NiimbotD11RequestCodePacket.IMAGE_CONFIRM }
+func (r ImageClear) Span() (int, int)  { return r.Row, r.Repeat }
+
+func (r ImageClear) Marshal() ([]byte, error) {
+	return rowHeader(r.Row, nil, r.Repeat)
+}
+
+// ParseImageRow reads a SET_IMAGE, SET_IMAGE_DATA or IMAGE_CLEAR packet of
+// a label width pixels wide, which sets the number of ink counts.
+func ParseImageRow(pkt *NiimbotPacket, width int) (ImageRow, error) {
+	codes := NiimbotD11RequestCodePacket
+	code := int(pkt.Type)
+	data := pkt.Data
+
+	chunks := 0
+	if code != codes.IMAGE_CLEAR {
+		chunks = (width + 31) / 32
+	}
+	if len(data) < 3+chunks {
+		return nil, fmt.Errorf("%w: image row", ErrShortPayload)
+	}
+	row := int(data[0])<<8 | int(data[1])
+	counts := data[2 : 2+chunks]
+	repeat := int(data[2+chunks])
+	body := data[3+chunks:]
+
+	switch code {
+	case codes.IMAGE_CLEAR:
+		return ImageClear{Row: row, Repeat: repeat}, nil
+	case codes.SET_IMAGE:
+		if len(body)%2 != 0 {
+			return nil, fmt.Errorf("%w: image row %d indexes", ErrShortPayload, row)
+		}
+		indexes := make([]int, 0, len(body)/2)
+		for i := 0; i < len(body); i += 2 {
+			indexes = append(indexes, int(body[i])<<8|int(body[i+1]))
+		}
+		return SetImage{Row: row, Counts: counts, Repeat: repeat, Indexes: indexes}, nil
+	case codes.SET_IMAGE_DATA:
+		return SetImageData{Row: row, Counts: counts, Repeat: repeat, Bitmap: body}, nil
+	}
+	return nil, fmt.Errorf("Packet %d is not an image row", code)
+}
+
+// Confirmation is the answer to most setters and print commands.
+type Confirmation struct {
+	OK bool
+}
+
+func ParseConfirmation(pkt *NiimbotPacket) (Confirmation, error) {
+	if len(pkt.Data) == 0 {
+		return Confirmation{}, fmt.Errorf("%w: confirmation %d", ErrShortPayload, pkt.Type)
+	}
+	return Confirmation{OK: pkt.Data[0] != 0}, nil
+}
+
+func (c Confirmation) Marshal() []byte {
+	if c.OK {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// PagePrintDone is sent by the printer, unasked, after each printed page.
+type PagePrintDone struct {
+	Page int
+}
+
+func ParsePagePrintDone(pkt *NiimbotPacket) (PagePrintDone, error) {
+	if len(pkt.Data) < 2 {
+		return PagePrintDone{}, fmt.Errorf("%w: page print done", ErrShortPayload)
+	}
+	return PagePrintDone{Page: int(pkt.Data[0])<<8 | int(pkt.Data[1])}, nil
+}
+
+func (r PagePrintDone) Code() int                { return NiimbotD11ResponseCodePacket.PAGE_PRINT_DONE }
+func (r PagePrintDone) Marshal() ([]byte, error) { return short("page", r.Page) }
+
+func rowHeader(row int, counts []byte, repeat int) ([]byte, error) {
+	data, err := short("row", row)
+	if err != nil {
+		return nil, err
+	}
+	if repeat < 0 || repeat > 255 {
+		return nil, fmt.Errorf("%w: repeat %d", ErrFieldRange, repeat)
+	}
+	data = append(data, counts...)
+	return append(data, byte(repeat)), nil
+}
+
+// short and byteField encode a field, failing when value does not fit.
+func short(name string, value int) ([]byte, error) {
+	data, err := helpers.ShortToByteArray(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %d", ErrFieldRange, name, value)
+	}
+	return data, nil
+}
+
+func byteField(name string, value int) ([]byte, error) {
+	if value < 0 || value > 255 {
+		return nil, fmt.Errorf("%w: %s %d", ErrFieldRange, name, value)
+	}
+	return []byte{byte(value)}, nil
+}
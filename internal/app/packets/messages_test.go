@@ -0,0 +1,66 @@
+package packets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRequestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want []byte
+	}{
+		{"set dimension", SetDimension{Width: 96, Height: 300}, []byte{0x01, 0x2c, 0x00, 0x60}},
+		{"set dimension with copies", SetDimension{Width: 384, Height: 240, Copies: 2}, []byte{0x00, 0xf0, 0x01, 0x80, 0x00, 0x02}},
+		{"start print with pages", StartPrint{TotalPages: 65535}, []byte{0xff, 0xff, 0, 0, 0, 0, 0}},
+		{"set quantity", SetQuantity{N: 258}, []byte{0x01, 0x02}},
+		{"set image", SetImage{Row: 256, Counts: []byte{1, 0, 0}, Repeat: 255, Indexes: []int{3}}, []byte{0x01, 0x00, 1, 0, 0, 255, 0x00, 0x03}},
+		{"image clear", ImageClear{Row: 2, Repeat: 1}, []byte{0x00, 0x02, 1}},
+		{"label type", SetLabelType{Type: 255}, []byte{255}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.req.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("got %x, want %x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestMarshalRange(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"height", SetDimension{Width: 96, Height: 65536}},
+		{"width", SetDimension{Width: -1, Height: 10}},
+		{"copies", SetDimension{Width: 96, Height: 10, Copies: 70000}},
+		{"total pages", StartPrint{TotalPages: 65536}},
+		{"quantity", SetQuantity{N: 65536}},
+		{"row", ImageClear{Row: 65536, Repeat: 1}},
+		{"repeat", SetImageData{Row: 0, Counts: []byte{0, 0, 0}, Repeat: 256}},
+		{"pixel index", SetImage{Row: 0, Counts: []byte{1, 0, 0}, Repeat: 1, Indexes: []int{65536}}},
+		{"label type", SetLabelType{Type: 256}},
+		{"density", SetLabelDensity{Density: -1}},
+		{"auto shutdown", SetAutoShutdown{Time: 300}},
+		{"info key", GetInfo{Key: 256}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.req.Marshal(); !errors.Is(err, ErrFieldRange) {
+				t.Errorf("got %v, want ErrFieldRange", err)
+			}
+			if _, err := RequestPacket(test.req); !errors.Is(err, ErrFieldRange) {
+				t.Errorf("RequestPacket got %v, want ErrFieldRange", err)
+			}
+		})
+	}
+}
@@ -7,6 +7,11 @@ import (
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
 )
 
+var (
+	ErrInvalidPacket   = errors.New("Invalid packet")
+	ErrInvalidChecksum = errors.New("Invalid checksum")
+)
+
 var NiimbotD11InfoPacket = newNiimbotD11InfoPackets()
 var NiimbotD11RequestCodePacket = newNiimbotD11RequestCodePackets()
 var NiimbotD11ResponseCodePacket = newNiimbotD11ResponseCodePackets()
@@ -56,6 +61,7 @@ type NiimbotRequestCodePackets struct {
 	IMAGE_CLEAR       int
 	SET_IMAGE_DATA    int
     IMAGE_CONFIRM     int
+	SET_AUTO_SHUTDOWN int
 }
 
 func newNiimbotD11RequestCodePackets() *NiimbotRequestCodePackets {
@@ -76,16 +82,21 @@ func newNiimbotD11RequestCodePackets() *NiimbotRequestCodePackets {
 		IMAGE_CLEAR:       132,
 		SET_IMAGE_DATA:    133,
         IMAGE_CONFIRM:     211,
+		SET_AUTO_SHUTDOWN: 39,
 	}
 }
 
 type NiimbotResponseCodePackets struct {
     PAGE_PRINT_DONE int
+	ILLEGAL_ARGUMENT int
+	NOT_IMPLEMENT    int
 }
 
 func newNiimbotD11ResponseCodePackets() *NiimbotResponseCodePackets {
     return &NiimbotResponseCodePackets{
         PAGE_PRINT_DONE: 224,
+		ILLEGAL_ARGUMENT: 219,
+		NOT_IMPLEMENT:    0,
     }
 }
 
@@ -114,13 +125,28 @@ func (np *NiimbotPacket) ToString() string {
 }
 
 func FromBytes(packet []byte) (*NiimbotPacket, error) {
+	np, err := parse(packet)
+	if err != nil {
+		logger.LogError(err.Error(), packet)
+		return nil, err
+	}
+	return np, nil
+}
+
+func parse(packet []byte) (*NiimbotPacket, error) {
+	if len(packet) < 7 {
+		return nil, ErrInvalidPacket
+	}
 	if packet[0] != 0x55 || packet[1] != 0x55 {
-        logger.LogError("Invalid packet", packet)
-		return nil, errors.New("Invalid packet")
+		return nil, ErrInvalidPacket
 	}
 	if packet[len(packet)-1] != 0xaa || packet[len(packet)-2] != 0xaa {
-        logger.LogError("Invalid packet", packet)
-		return nil, errors.New("Invalid packet")
+		return nil, ErrInvalidPacket
+	}
+
+	length := int(packet[3])
+	if length != len(packet)-7 {
+		return nil, fmt.Errorf("%w: length mismatch", ErrInvalidPacket)
 	}
 
 	np := &NiimbotPacket{
@@ -128,15 +154,12 @@ func FromBytes(packet []byte) (*NiimbotPacket, error) {
 		Data: packet[4 : len(packet)-3],
 	}
 
-	length := int(packet[3])
-
 	checksum := int(np.Type) ^ length
 	for _, b := range np.Data {
 		checksum ^= int(b)
 	}
 	if byte(checksum) != packet[len(packet)-3] {
-        logger.LogError("Invalid checksum", packet)
-		return nil, errors.New("Invalid checksum")
+		return nil, ErrInvalidChecksum
 	}
 	return np, nil
 }
@@ -0,0 +1,48 @@
+package serialsocket
+
+import (
+	"fmt"
+	"strings"
+
+	"go.bug.st/serial"
+)
+
+// CommonBaudRates are tried in order when probing for the printer's speed.
+var CommonBaudRates = []int{9600, 115200, 57600, 38400, 19200, 230400}
+
+func DefaultMode() serial.Mode {
+	return serial.Mode{
+		BaudRate: 9600,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+}
+
+func ParseParity(parity string) (serial.Parity, error) {
+	switch strings.ToLower(parity) {
+	case "none", "n":
+		return serial.NoParity, nil
+	case "odd", "o":
+		return serial.OddParity, nil
+	case "even", "e":
+		return serial.EvenParity, nil
+	case "mark", "m":
+		return serial.MarkParity, nil
+	case "space", "s":
+		return serial.SpaceParity, nil
+	}
+	return serial.NoParity, fmt.Errorf("Invalid parity %q", parity)
+}
+
+func ParseStopBits(stopBits string) (serial.StopBits, error) {
+	switch stopBits {
+	case "1":
+		return serial.OneStopBit, nil
+	case "1.5":
+		return serial.OnePointFiveStopBits, nil
+	case "2":
+		return serial.TwoStopBits, nil
+	}
+	return serial.OneStopBit, fmt.Errorf("Invalid stop bits %q", stopBits)
+}
@@ -1,43 +1,155 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"image"
+	"image/png"
+	"os"
+	"os/signal"
+	"time"
 
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/helpers"
+	image_encoder "github.com/matheustavarestrindade/niimprintgo/internal/app/image"
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
 	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
 )
 
-type DefaultParameters struct {
-	LabelType    int
-	LabelDensity int
-	Quantity     int
-	ImagePath    string
-	ComPort      string
+var commands = map[string]func(args []string){
+	"emulate":  runEmulate,
+	"discover": runDiscover,
+	"config":   runConfig,
+	"decode":   runDecode,
+	"info":     runInfo,
+	"monitor":  runMonitor,
+}
 
+type LoggerParameters struct {
 	LoggerEnableDebug  bool
 	LoggerEnableInfo   bool
 	LoggerEnableError  bool
 	LoggerEnableColors bool
 }
 
+func (lp *LoggerParameters) RegisterFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&lp.LoggerEnableDebug, "debug", false, "Enable debug logs")
+	flags.BoolVar(&lp.LoggerEnableInfo, "info", true, "Enable info logs")
+	flags.BoolVar(&lp.LoggerEnableError, "error", true, "Enable error logs")
+	flags.BoolVar(&lp.LoggerEnableColors, "colors", true, "Enable colors in logs")
+}
+
+func (lp *LoggerParameters) ConfigureLogger() {
+	logger.ConfigureLogger(lp.LoggerEnableInfo, lp.LoggerEnableError, lp.LoggerEnableDebug, lp.LoggerEnableColors)
+}
+
+type DefaultParameters struct {
+	LoggerParameters
+	SerialParameters
+
+	Model          string
+	LabelType      int
+	LabelDensity   int
+	Quantity       int
+	ImagePath      string
+	Timeout        time.Duration
+	LabelWidth     int
+	LabelHeight    int
+	Rotate         string
+	Fit            string
+	Align          string
+	Filter         string
+	Upscale        bool
+	Alpha          string
+	Background     string
+	Dither         string
+	Threshold      int
+	ThresholdMode  string
+	AdaptiveRadius int
+	AdaptiveOffset float64
+	Preview        string
+}
+
 func (dp *DefaultParameters) IsValidConfig() bool {
-	if dp.ComPort == "" {
-		logger.LogError("COM port is required")
+	if !dp.SerialParameters.IsValidConfig() {
 		return false
 	}
-	if dp.LabelType > 3 || dp.LabelType < 1 {
+	if dp.Model != "" {
+		profile, ok := niimbot.ProfileByModel(dp.Model)
+		if !ok {
+			logger.LogError("Unknown printer model", dp.Model)
+			return false
+		}
+		if err := profile.ValidLabelType(dp.LabelType); err != nil {
+			logger.LogError(err.Error())
+			return false
+		}
+		if dp.LabelDensity != 0 {
+			if err := profile.ValidDensity(dp.LabelDensity); err != nil {
+				logger.LogError(err.Error())
+				return false
+			}
+		}
+	}
+	if dp.LabelType < 1 {
 		logger.LogError("Invalid label type", dp.LabelType)
 		return false
 	}
-	if dp.LabelDensity > 3 || dp.LabelDensity < 0 {
-		logger.LogError("Invalid label density", dp)
+	if dp.LabelDensity < 0 {
+		logger.LogError("Invalid label density", dp.LabelDensity)
 		return false
 	}
 	if dp.Quantity < 1 {
 		logger.LogError("Invalid quantity", dp.Quantity)
 		return false
 	}
+	if dp.LabelWidth < 0 || dp.LabelHeight < 0 {
+		logger.LogError("Invalid label size", dp.LabelWidth, dp.LabelHeight)
+		return false
+	}
+	if _, err := image_encoder.ParseRotation(dp.Rotate); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseFitMode(dp.Fit); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseAlign(dp.Align); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseFilter(dp.Filter); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseAlphaMode(dp.Alpha); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseColor(dp.Background); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseDither(dp.Dither); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if _, err := image_encoder.ParseThresholdMode(dp.ThresholdMode); err != nil {
+		logger.LogError(err.Error())
+		return false
+	}
+	if dp.Threshold < 0 || dp.Threshold > 255 {
+		logger.LogError("Invalid threshold", dp.Threshold)
+		return false
+	}
+	if dp.AdaptiveRadius < 0 {
+		logger.LogError("Invalid adaptive radius", dp.AdaptiveRadius)
+		return false
+	}
+	if dp.AdaptiveOffset < -255 || dp.AdaptiveOffset > 255 {
+		logger.LogError("Invalid adaptive offset", dp.AdaptiveOffset)
+		return false
+	}
 	if dp.ImagePath == "" {
 		logger.LogError("Image path is required")
 		return false
@@ -50,52 +162,134 @@ func (dp *DefaultParameters) IsValidConfig() bool {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+	runPrint(os.Args[1:])
+}
 
-	initParams := readParams() 
+func runPrint(args []string) {
 
-	logger.ConfigureLogger(initParams.LoggerEnableInfo, initParams.LoggerEnableError, initParams.LoggerEnableDebug, initParams.LoggerEnableColors)
+	initParams := readParams(args)
+
+	initParams.ConfigureLogger()
 
 	if !initParams.IsValidConfig() {
 		return
 	}
 
-	logger.LogInfo("Starting Niimprintgo...")
-	printer := niimbot.NewNiimbotPrinter(initParams.ComPort)
-
 	img := helpers.GetImageFromFilePath(initParams.ImagePath)
 	if img == nil {
 		return
 	}
+	options := initParams.PrintOptions()
+
+	if initParams.Preview != "" {
+		profile := niimbot.DefaultProfile
+		if initParams.Model != "" {
+			profile, _ = niimbot.ProfileByModel(initParams.Model)
+		}
+		if err := writePNG(initParams.Preview, options.Preview(img, profile)); err != nil {
+			logger.LogError("Error writing preview", err)
+			return
+		}
+		logger.LogInfo("Wrote", profile.Model, "preview to", initParams.Preview)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if initParams.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, initParams.Timeout)
+		defer cancel()
+	}
+
+	logger.LogInfo("Starting Niimprintgo...")
+	printer, err := initParams.Connect(ctx)
+	if err != nil {
+		logger.LogError("Error connecting to printer", err)
+		return
+	}
+	defer printer.Close()
+	if initParams.Model != "" {
+		printer.Profile, _ = niimbot.ProfileByModel(initParams.Model)
+	}
 
 	logger.LogInfo("Printing label...")
-	printer.PrintLabel(img, initParams.LabelType, initParams.LabelDensity, initParams.Quantity)
+	if err := printer.PrintLabelWithOptions(ctx, img, options); err != nil {
+		logger.LogError("Error printing label", err)
+	}
 }
 
-func readParams() DefaultParameters {
+// PrintOptions builds the print job from the flags, which IsValidConfig has
+// already checked.
+func (dp *DefaultParameters) PrintOptions() niimbot.PrintOptions {
+	options := niimbot.DefaultPrintOptions()
+	options.LabelType = dp.LabelType
+	options.LabelDensity = dp.LabelDensity
+	options.Quantity = dp.Quantity
+	options.LabelWidth = dp.LabelWidth
+	options.LabelHeight = dp.LabelHeight
+	options.Image.Rotation, _ = image_encoder.ParseRotation(dp.Rotate)
+	options.Image.Fit, _ = image_encoder.ParseFitMode(dp.Fit)
+	options.Image.Align, _ = image_encoder.ParseAlign(dp.Align)
+	options.Image.Filter, _ = image_encoder.ParseFilter(dp.Filter)
+	options.Image.Upscale = dp.Upscale
+	options.Image.Alpha, _ = image_encoder.ParseAlphaMode(dp.Alpha)
+	options.Image.Background, _ = image_encoder.ParseColor(dp.Background)
+	options.Image.Dither, _ = image_encoder.ParseDither(dp.Dither)
+	options.Image.ThresholdMode, _ = image_encoder.ParseThresholdMode(dp.ThresholdMode)
+	options.Image.Threshold = dp.Threshold
+	options.Image.AdaptiveRadius = dp.AdaptiveRadius
+	options.Image.AdaptiveOffset = dp.AdaptiveOffset
+	return options
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readParams(args []string) DefaultParameters {
 
 	initParams := DefaultParameters{}
-    debug := flag.Bool("debug", false, "Enable debug logs")
-    info := flag.Bool("info", true, "Enable info logs")
-    error := flag.Bool("error", true, "Enable error logs")
-    colors := flag.Bool("colors", true, "Enable colors in logs")
-    labelType := flag.Int("labelType", 1, "Label type")
-    labelDensity := flag.Int("labelDensity", 2, "Label density")
-    quantity := flag.Int("quantity", 1, "Quantity")
-    comPort := flag.String("comPort", "", "COM port")
-    imagePath := flag.String("imagePath", "", "Image path")
-
-
-	flag.Parse()
-
-    initParams.LoggerEnableDebug = *debug 
-	initParams.LoggerEnableInfo = *info 
-	initParams.LoggerEnableError = *error 
-	initParams.LoggerEnableColors = *colors 
-	initParams.LabelType = *labelType
-	initParams.LabelDensity = *labelDensity
-	initParams.Quantity = *quantity
-	initParams.ComPort = *comPort
-	initParams.ImagePath = *imagePath
+	flags := flag.NewFlagSet("NiimprintGO", flag.ExitOnError)
+	initParams.LoggerParameters.RegisterFlags(flags)
+	initParams.SerialParameters.RegisterFlags(flags)
+	flags.IntVar(&initParams.LabelType, "labelType", 1, "Label type")
+	flags.StringVar(&initParams.Model, "model", "", "Printer model, detected from the printer when empty")
+	flags.IntVar(&initParams.LabelDensity, "labelDensity", 0, "Label density, 0 uses the model's default")
+	flags.IntVar(&initParams.Quantity, "quantity", 1, "Quantity")
+	flags.StringVar(&initParams.ImagePath, "imagePath", "", "Image path")
+	flags.IntVar(&initParams.LabelWidth, "labelWidth", 0, "Label width in dots, 0 uses the printhead width")
+	flags.IntVar(&initParams.LabelHeight, "labelHeight", 0, "Label length in dots, 0 follows the image")
+	flags.StringVar(&initParams.Rotate, "rotate", string(image_encoder.RotateAuto), "Clockwise rotation before printing: 0, 90, 180, 270 or auto")
+	flags.StringVar(&initParams.Fit, "fit", string(image_encoder.FitContain), "Fit the image to the label: contain, cover, stretch or none")
+	flags.StringVar(&initParams.Align, "align", string(image_encoder.AlignCenter), "Image position along the label: center, top or bottom")
+	flags.StringVar(&initParams.Filter, "filter", string(image_encoder.FilterLanczos), "Resample filter: nearest, box, linear, catmull-rom or lanczos")
+	flags.StringVar(&initParams.Alpha, "alpha", string(image_encoder.AlphaBackground), "Transparency: background composites onto --background, ink prints by opacity")
+	flags.StringVar(&initParams.Background, "background", "white", "Color behind transparent pixels: white, black or hex such as #ffcc00")
+	flags.BoolVar(&initParams.Upscale, "upscale", false, "Let --fit=contain enlarge images smaller than the label")
+	flags.StringVar(&initParams.Dither, "dither", string(image_encoder.DitherThreshold), "Dithering: threshold, floyd-steinberg, atkinson, stucki, bayer4 or bayer8")
+	flags.IntVar(&initParams.Threshold, "threshold", 128, "Luminance (0-255) below which pixels print")
+	flags.StringVar(&initParams.ThresholdMode, "thresholdMode", string(image_encoder.ThresholdFixed), "Threshold: fixed, otsu or adaptive")
+	flags.IntVar(&initParams.AdaptiveRadius, "adaptiveRadius", 7, "Neighbourhood radius in pixels for the adaptive threshold")
+	flags.Float64Var(&initParams.AdaptiveOffset, "adaptiveOffset", 10, "How much darker than its neighbourhood a pixel must be to print, adaptive threshold")
+	flags.StringVar(&initParams.Preview, "preview", "", "Write the label as it would print to this PNG file instead of printing")
+	flags.DurationVar(&initParams.Timeout, "timeout", 0, "Abort the print job after this duration (0 disables)")
+
+	flags.Parse(args)
 
 	return initParams
 }
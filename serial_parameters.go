@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/capture"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/helpers"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/logger"
+	"github.com/matheustavarestrindade/niimprintgo/internal/app/niimbot"
+	serialsocket "github.com/matheustavarestrindade/niimprintgo/internal/app/socket"
+	"go.bug.st/serial"
+)
+
+type SerialParameters struct {
+	ComPort  string
+	BaudRate int
+	DataBits int
+	Parity   string
+	StopBits string
+	AutoBaud bool
+	Capture  string
+	Replay   string
+}
+
+func (sp *SerialParameters) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&sp.ComPort, "comPort", "", "COM port (found automatically when exactly one printer is connected)")
+	flags.IntVar(&sp.BaudRate, "baudRate", 9600, "Serial baud rate")
+	flags.IntVar(&sp.DataBits, "dataBits", 8, "Serial data bits (5, 6, 7 or 8)")
+	flags.StringVar(&sp.Parity, "parity", "none", "Serial parity (none, odd, even, mark or space)")
+	flags.StringVar(&sp.StopBits, "stopBits", "1", "Serial stop bits (1, 1.5 or 2)")
+	flags.BoolVar(&sp.AutoBaud, "autoBaud", false, "Probe common baud rates and use the first one the printer answers on")
+	flags.StringVar(&sp.Capture, "capture", "", "Record the raw bytes sent and received to this JSONL file")
+	flags.StringVar(&sp.Replay, "replay", "", "Talk to a capture file played back instead of a real printer")
+}
+
+func (sp *SerialParameters) Mode() (serial.Mode, error) {
+	mode := serialsocket.DefaultMode()
+	mode.BaudRate = sp.BaudRate
+	mode.DataBits = sp.DataBits
+
+	parity, err := serialsocket.ParseParity(sp.Parity)
+	if err != nil {
+		return mode, err
+	}
+	mode.Parity = parity
+
+	stopBits, err := serialsocket.ParseStopBits(sp.StopBits)
+	if err != nil {
+		return mode, err
+	}
+	mode.StopBits = stopBits
+
+	if mode.BaudRate <= 0 {
+		return mode, errors.New("Invalid baud rate")
+	}
+	if mode.DataBits < 5 || mode.DataBits > 8 {
+		return mode, errors.New("Invalid data bits")
+	}
+	return mode, nil
+}
+
+func (sp *SerialParameters) IsValidConfig() bool {
+	if _, err := sp.Mode(); err != nil {
+		logger.LogError("Invalid serial settings", err)
+		return false
+	}
+	if sp.Replay != "" && !helpers.FileExists(sp.Replay) {
+		logger.LogError("Capture file not found", sp.Replay)
+		return false
+	}
+	return true
+}
+
+func (sp *SerialParameters) Connect(ctx context.Context) (*niimbot.NiimbotPrinter, error) {
+	if sp.Replay != "" {
+		records, err := capture.ReadFile(sp.Replay)
+		if err != nil {
+			return nil, err
+		}
+		logger.LogInfo("Replaying", len(records), "frames from", sp.Replay)
+		return niimbot.NewNiimbotPrinterWithTransport(capture.NewReplay(records)), nil
+	}
+
+	mode, err := sp.Mode()
+	if err != nil {
+		return nil, err
+	}
+	if sp.ComPort == "" {
+		logger.LogInfo("No COM port given, searching for printers...")
+		sp.ComPort, err = niimbot.FindPrinter(ctx, mode)
+		if err != nil {
+			return nil, err
+		}
+		logger.LogInfo("Found printer on", sp.ComPort)
+	}
+	if sp.AutoBaud {
+		// Try the configured rate first, then the common ones
+		baudRates := []int{mode.BaudRate}
+		for _, baudRate := range serialsocket.CommonBaudRates {
+			if baudRate != mode.BaudRate {
+				baudRates = append(baudRates, baudRate)
+			}
+		}
+		logger.LogInfo("Probing baud rates on", sp.ComPort)
+		if sp.Capture == "" {
+			return niimbot.ConnectAutoBaud(ctx, sp.ComPort, mode, baudRates)
+		}
+		mode.BaudRate, err = niimbot.ProbeBaudRate(ctx, sp.ComPort, mode, baudRates)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sp.Capture == "" {
+		return niimbot.NewNiimbotPrinterWithMode(sp.ComPort, mode)
+	}
+
+	writer, err := capture.Create(sp.Capture)
+	if err != nil {
+		return nil, err
+	}
+	socket := serialsocket.NewSerialSocketWithMode(sp.ComPort, mode)
+	socket.Wrap = func(port serial.Port) serial.Port {
+		return capture.NewRecorder(port, writer)
+	}
+	if err := socket.Connect(); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	logger.LogInfo("Connected to", sp.ComPort, "at", mode.BaudRate, "baud")
+	logger.LogInfo("Capturing traffic to", sp.Capture)
+	return niimbot.NewNiimbotPrinterWithTransport(socket), nil
+}